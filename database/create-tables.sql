@@ -1,8 +1,14 @@
 USE `retro-games`;
 
-DROP TABLE IF EXISTS `users`;
-DROP TABLE IF EXISTS `games`;
+DROP TABLE IF EXISTS `deliveries`;
+DROP TABLE IF EXISTS `digest_entries`;
+DROP TABLE IF EXISTS `notification_preferences`;
+DROP TABLE IF EXISTS `outbox`;
+DROP TABLE IF EXISTS `offer_events`;
+DROP TABLE IF EXISTS `offer_items`;
 DROP TABLE IF EXISTS `offers`;
+DROP TABLE IF EXISTS `games`;
+DROP TABLE IF EXISTS `users`;
 
 CREATE TABLE `users` (
   `userId` int NOT NULL AUTO_INCREMENT,
@@ -14,17 +20,56 @@ CREATE TABLE `users` (
   UNIQUE KEY `email` (`email`)
 );
 
+CREATE TABLE `notification_preferences` (
+  `userId` int NOT NULL,
+  `channels` set('smtp','webhook','file') NOT NULL DEFAULT 'smtp,webhook,file',
+  `mutedEvents` set('offer.created','offer.accepted','offer.rejected','offer.cancelled','offer.countered','offer.expired','user.created','user.updated') NOT NULL DEFAULT '',
+  `delivery` enum('immediate','daily','weekly') NOT NULL DEFAULT 'immediate',
+  PRIMARY KEY (`userId`),
+  FOREIGN KEY (`userId`) REFERENCES `users` (`userId`) ON DELETE CASCADE
+);
+
+CREATE TABLE `digest_entries` (
+  `digestEntryId` int NOT NULL AUTO_INCREMENT,
+  `userId` int NOT NULL,
+  `delivery` enum('daily','weekly') NOT NULL,
+  `notification` text NOT NULL,
+  `createdAt` datetime NOT NULL,
+  PRIMARY KEY (`digestEntryId`),
+  KEY `due` (`delivery`, `createdAt`),
+  KEY `userId` (`userId`, `delivery`),
+  FOREIGN KEY (`userId`) REFERENCES `users` (`userId`) ON DELETE CASCADE
+);
+
+CREATE TABLE `deliveries` (
+  `eventId` varchar(64) NOT NULL,
+  `userId` int NOT NULL,
+  `channel` varchar(32) NOT NULL,
+  `status` enum('claimed','sent') NOT NULL,
+  `claimedAt` datetime NOT NULL,
+  `sentAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`eventId`, `userId`, `channel`)
+);
+
 CREATE TABLE `games` (
   `gameId` int NOT NULL AUTO_INCREMENT,
   `userId` int NOT NULL,
-  `name` varchar(255) DEFAULT NULL,
+  `name` varchar(255) NOT NULL,
   `publisher` varchar(255) DEFAULT NULL,
-  `year` int DEFAULT NULL,
+  `year` int NOT NULL,
   `system` varchar(255) DEFAULT NULL,
-  `condition` enum('mint','good','fair','poor') DEFAULT NULL,
+  `condition` enum('mint','good','fair','poor') NOT NULL,
   `owners` int DEFAULT NULL,
+  `createdAt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (`gameId`),
   KEY `userId` (`userId`),
+  KEY `name` (`name`),
+  KEY `system` (`system`),
+  KEY `condition` (`condition`),
+  KEY `publisher` (`publisher`),
+  KEY `year` (`year`),
+  KEY `createdAt` (`createdAt`),
+  FULLTEXT KEY `search` (`name`, `publisher`),
   FOREIGN KEY (`userId`) REFERENCES `users` (`userId`)
 );
 
@@ -32,12 +77,53 @@ CREATE TABLE `offers` (
   `offerId` int NOT NULL AUTO_INCREMENT,
   `offererUserId` int NOT NULL,
   `recipientUserId` int NOT NULL,
-  `offererGameId` int NOT NULL,
-  `recipientGameId` int NOT NULL,
-  `status` enum('pending', 'cancelled', 'rejected', 'accepted') DEFAULT 'pending',
+  `status` enum('pending', 'cancelled', 'rejected', 'accepted', 'countered', 'expired') DEFAULT 'pending',
+  `parentOfferId` int DEFAULT NULL,
+  `createdAt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `expiresAt` datetime NOT NULL,
   PRIMARY KEY (`offerId`),
+  KEY `createdAt` (`createdAt`),
+  KEY `expiring` (`status`, `expiresAt`),
+  KEY `parentOfferId` (`parentOfferId`),
   FOREIGN KEY (`offererUserId`) REFERENCES `users` (`userId`),
   FOREIGN KEY (`recipientUserId`) REFERENCES `users` (`userId`),
-  FOREIGN KEY (`offererGameId`) REFERENCES `games` (`gameId`),
-  FOREIGN KEY (`recipientGameId`) REFERENCES `games` (`gameId`)
-);
\ No newline at end of file
+  FOREIGN KEY (`parentOfferId`) REFERENCES `offers` (`offerId`) ON DELETE SET NULL
+);
+
+CREATE TABLE `offer_items` (
+  `offerId` int NOT NULL,
+  `gameId` int NOT NULL,
+  `side` enum('offerer', 'recipient') NOT NULL,
+  PRIMARY KEY (`offerId`, `gameId`),
+  KEY `gameId` (`gameId`),
+  FOREIGN KEY (`offerId`) REFERENCES `offers` (`offerId`) ON DELETE CASCADE,
+  FOREIGN KEY (`gameId`) REFERENCES `games` (`gameId`)
+);
+
+CREATE TABLE `offer_events` (
+  `offerEventId` int NOT NULL AUTO_INCREMENT,
+  `offerId` int NOT NULL,
+  `fromStatus` enum('pending', 'cancelled', 'rejected', 'accepted', 'countered', 'expired') DEFAULT NULL,
+  `toStatus` enum('pending', 'cancelled', 'rejected', 'accepted', 'countered', 'expired') NOT NULL,
+  `actorUserId` int DEFAULT NULL,
+  `reason` text DEFAULT NULL,
+  `createdAt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`offerEventId`),
+  KEY `offerId` (`offerId`),
+  FOREIGN KEY (`offerId`) REFERENCES `offers` (`offerId`) ON DELETE RESTRICT
+);
+
+CREATE TABLE `outbox` (
+  `outboxId` int NOT NULL AUTO_INCREMENT,
+  `topic` varchar(255) NOT NULL,
+  `key` varchar(255) NOT NULL,
+  `value` text NOT NULL,
+  `attempts` int NOT NULL DEFAULT 0,
+  `lastError` text DEFAULT NULL,
+  `createdAt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `nextAttemptAt` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `sentAt` datetime DEFAULT NULL,
+  PRIMARY KEY (`outboxId`),
+  KEY `unsent` (`sentAt`, `nextAttemptAt`),
+  KEY `keyed` (`topic`, `key`, `sentAt`)
+);
@@ -0,0 +1,183 @@
+// Package events defines the messages gametrader publishes to Kafka and trademailer consumes.
+//
+// Each message is a JSON Envelope keyed by the id of the offer or user it's about. Messages written
+// before envelopes were introduced used the event type as the key and only the id as the value;
+// DecodeOfferEvent and DecodeUserEvent still accept those and return a legacy envelope (version 0)
+// whose snapshot only has the id filled in.
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The envelope version written by NewEnvelope. Bump it when a change to the envelope or its
+// snapshots isn't backward compatible.
+//
+// Version 2 replaced the single game on each side of an offer with lists of games. Version 1
+// envelopes are still decoded, with their games moved into the lists.
+const SchemaVersion = 2
+
+// Event types
+const (
+	Created   = "created"
+	Accepted  = "accepted"
+	Rejected  = "rejected"
+	Cancelled = "cancelled"
+	Countered = "countered"
+	Expired   = "expired"
+	Updated   = "updated"
+)
+
+type Envelope struct {
+	Version    int       `json:"version"`
+	EventId    string    `json:"eventId"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurredAt"`
+	// The user whose request caused the event, if there was one
+	ActorId *int   `json:"actorId,omitempty"`
+	Offer   *Offer `json:"offer,omitempty"`
+	User    *User  `json:"user,omitempty"`
+}
+
+// Snapshot of an offer, its users and its games at the time of the event
+type Offer struct {
+	OfferId   int    `json:"offerId"`
+	Status    string `json:"status"`
+	Offerer   User   `json:"offerer"`
+	Recipient User   `json:"recipient"`
+	// The games each user gives up in the trade
+	OffererGames   []Game `json:"offererGames"`
+	RecipientGames []Game `json:"recipientGames"`
+	// The offer this one counters, if it's a counter-offer
+	ParentOfferId *int `json:"parentOfferId,omitempty"`
+
+	// The single game on each side of a version 1 offer. Decoding moves them into the lists.
+	OffererGame   *Game `json:"offererGame,omitempty"`
+	RecipientGame *Game `json:"recipientGame,omitempty"`
+}
+
+// Snapshot of a user. Never includes the password.
+type User struct {
+	UserId int    `json:"userId"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+}
+
+type Game struct {
+	GameId    int    `json:"gameId"`
+	Name      string `json:"name"`
+	Publisher string `json:"publisher"`
+	Year      int    `json:"year"`
+	System    string `json:"system"`
+	Condition string `json:"condition"`
+}
+
+// Creates an envelope for a new event with a fresh event id.
+func NewEnvelope(eventType string, actorId *int) (*Envelope, error) {
+	eventId, err := newEventId()
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Version:    SchemaVersion,
+		EventId:    eventId,
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		ActorId:    actorId,
+	}, nil
+}
+
+// Reports whether the envelope was decoded from a message that only carried an id.
+func (e *Envelope) IsLegacy() bool {
+	return e.Version == 0
+}
+
+// Returns the Kafka key for the envelope: the id of the offer or user it's about, so that every
+// event for the same offer or user lands on the same partition.
+func (e *Envelope) Key() string {
+	switch {
+	case e.Offer != nil:
+		return strconv.Itoa(e.Offer.OfferId)
+	case e.User != nil:
+		return strconv.Itoa(e.User.UserId)
+	}
+	return e.EventId
+}
+
+func DecodeOfferEvent(key []byte, value []byte) (*Envelope, error) {
+	if id, ok := legacyId(value); ok {
+		return &Envelope{Type: string(key), Offer: &Offer{OfferId: id}}, nil
+	}
+	envelope, err := decode(value)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Offer == nil {
+		return nil, fmt.Errorf("offer event %v has no offer", envelope.EventId)
+	}
+	return envelope, nil
+}
+
+func DecodeUserEvent(key []byte, value []byte) (*Envelope, error) {
+	if id, ok := legacyId(value); ok {
+		return &Envelope{Type: string(key), User: &User{UserId: id}}, nil
+	}
+	envelope, err := decode(value)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.User == nil {
+		return nil, fmt.Errorf("user event %v has no user", envelope.EventId)
+	}
+	return envelope, nil
+}
+
+func decode(value []byte) (*Envelope, error) {
+	var envelope Envelope
+	err := json.Unmarshal(value, &envelope)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Version < 1 || envelope.Version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported event version %v", envelope.Version)
+	}
+	if envelope.Offer != nil {
+		envelope.Offer.upgrade()
+	}
+	return &envelope, nil
+}
+
+// Moves the games of a version 1 offer into the lists.
+func (o *Offer) upgrade() {
+	if o.OffererGame != nil && len(o.OffererGames) == 0 {
+		o.OffererGames = []Game{*o.OffererGame}
+	}
+	if o.RecipientGame != nil && len(o.RecipientGames) == 0 {
+		o.RecipientGames = []Game{*o.RecipientGame}
+	}
+	o.OffererGame = nil
+	o.RecipientGame = nil
+}
+
+// Legacy messages carry nothing but the integer id of the offer or user.
+func legacyId(value []byte) (int, bool) {
+	id, err := strconv.Atoi(string(bytes.TrimSpace(value)))
+	return id, err == nil
+}
+
+// Generates a random (version 4) UUID.
+func newEventId() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeOfferEventLegacy(t *testing.T) {
+	event, err := DecodeOfferEvent([]byte(Accepted), []byte("42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !event.IsLegacy() || event.Type != Accepted || event.Offer.OfferId != 42 {
+		t.Fatalf("unexpected legacy event %+v", event)
+	}
+}
+
+func TestDecodeOfferEventEnvelope(t *testing.T) {
+	actorId := 7
+	sent, err := NewEnvelope(Created, &actorId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent.Offer = &Offer{OfferId: 42, Status: "pending"}
+	value, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := DecodeOfferEvent([]byte(sent.Key()), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.IsLegacy() || event.EventId != sent.EventId || event.Type != Created || *event.ActorId != actorId || event.Offer.OfferId != 42 {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if sent.Key() != "42" {
+		t.Fatalf("expected the offer id as the key, got %v", sent.Key())
+	}
+}
+
+func TestDecodeUserEventRejectsUnknownVersion(t *testing.T) {
+	_, err := DecodeUserEvent([]byte("1"), []byte(`{"version": 99, "user": {"userId": 1}}`))
+	if err == nil {
+		t.Fatal("expected an error for an unsupported version")
+	}
+}
+
+func TestDecodeOfferEventUpgradesVersion1(t *testing.T) {
+	value := `{"version": 1, "eventId": "e1", "type": "created", "offer": {"offerId": 42, "status": "pending",
+		"offererGame": {"gameId": 10, "name": "Halo"}, "recipientGame": {"gameId": 20, "name": "Zelda"}}}`
+	event, err := DecodeOfferEvent([]byte("42"), []byte(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer := event.Offer
+	if len(offer.OffererGames) != 1 || offer.OffererGames[0].GameId != 10 {
+		t.Errorf("expected the offerer game in the list, got %+v", offer.OffererGames)
+	}
+	if len(offer.RecipientGames) != 1 || offer.RecipientGames[0].GameId != 20 {
+		t.Errorf("expected the recipient game in the list, got %+v", offer.RecipientGames)
+	}
+	if offer.OffererGame != nil || offer.RecipientGame != nil {
+		t.Errorf("expected the version 1 games to be cleared, got %+v and %+v", offer.OffererGame, offer.RecipientGame)
+	}
+}
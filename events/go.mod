@@ -0,0 +1,3 @@
+module github.com/robertjshirts/events
+
+go 1.22.0
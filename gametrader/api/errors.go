@@ -0,0 +1,11 @@
+package api
+
+import "errors"
+
+// Errors returned by the service layer that the handlers map to specific status codes.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrBadRequest   = errors.New("bad request")
+)
@@ -20,6 +20,9 @@ import (
 
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// Log in with email and password
+	// (POST /auth/login)
+	Login(c *gin.Context)
 	// Get multiple games
 	// (GET /games)
 	GetGames(c *gin.Context, params GetGamesParams)
@@ -50,6 +53,15 @@ type ServerInterface interface {
 	// Update the status of the offer
 	// (PATCH /offers/{offerId})
 	UpdateOffer(c *gin.Context, offerId OfferId)
+	// Counter an offer
+	// (POST /offers/{offerId}/counter)
+	CounterOffer(c *gin.Context, offerId OfferId)
+	// Retrieve the audit trail of an offer
+	// (GET /offers/{offerId}/events)
+	GetOfferEvents(c *gin.Context, offerId OfferId)
+	// Retrieve the negotiation an offer is part of
+	// (GET /offers/{offerId}/history)
+	GetOfferHistory(c *gin.Context, offerId OfferId)
 	// Create a user
 	// (POST /users)
 	CreateUser(c *gin.Context)
@@ -62,6 +74,12 @@ type ServerInterface interface {
 	// Update some of the user data
 	// (PATCH /users/{userId})
 	UpdateUser(c *gin.Context, userId UserId)
+	// Retrieve the user's notification preferences
+	// (GET /users/{userId}/preferences)
+	GetPreferences(c *gin.Context, userId UserId)
+	// Replace the user's notification preferences
+	// (PUT /users/{userId}/preferences)
+	UpdatePreferences(c *gin.Context, userId UserId)
 }
 
 // ServerInterfaceWrapper converts contexts to parameters.
@@ -73,6 +91,19 @@ type ServerInterfaceWrapper struct {
 
 type MiddlewareFunc func(c *gin.Context)
 
+// Login operation middleware
+func (siw *ServerInterfaceWrapper) Login(c *gin.Context) {
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.Login(c)
+}
+
 // GetGames operation middleware
 func (siw *ServerInterfaceWrapper) GetGames(c *gin.Context) {
 
@@ -89,11 +120,19 @@ func (siw *ServerInterfaceWrapper) GetGames(c *gin.Context) {
 		return
 	}
 
-	// ------------- Optional query parameter "offset" -------------
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", c.Request.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter cursor: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "offset", c.Request.URL.Query(), &params.Offset)
+	err = runtime.BindQueryParameter("form", true, false, "sort", c.Request.URL.Query(), &params.Sort)
 	if err != nil {
-		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter offset: %w", err), http.StatusBadRequest)
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter sort: %w", err), http.StatusBadRequest)
 		return
 	}
 
@@ -105,6 +144,70 @@ func (siw *ServerInterfaceWrapper) GetGames(c *gin.Context) {
 		return
 	}
 
+	// ------------- Optional query parameter "name" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "name", c.Request.URL.Query(), &params.Name)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter name: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "q" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "q", c.Request.URL.Query(), &params.Q)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter q: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "system" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "system", c.Request.URL.Query(), &params.System)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter system: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "condition" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "condition", c.Request.URL.Query(), &params.Condition)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter condition: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "publisher" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "publisher", c.Request.URL.Query(), &params.Publisher)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter publisher: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "minYear" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "minYear", c.Request.URL.Query(), &params.MinYear)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter minYear: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "maxYear" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "maxYear", c.Request.URL.Query(), &params.MaxYear)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter maxYear: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "excludeUserId" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "excludeUserId", c.Request.URL.Query(), &params.ExcludeUserId)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter excludeUserId: %w", err), http.StatusBadRequest)
+		return
+	}
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -118,6 +221,8 @@ func (siw *ServerInterfaceWrapper) GetGames(c *gin.Context) {
 // CreateGame operation middleware
 func (siw *ServerInterfaceWrapper) CreateGame(c *gin.Context) {
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -142,6 +247,8 @@ func (siw *ServerInterfaceWrapper) DeleteGame(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -190,6 +297,8 @@ func (siw *ServerInterfaceWrapper) UpdateGame(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -205,6 +314,8 @@ func (siw *ServerInterfaceWrapper) GetOffers(c *gin.Context) {
 
 	var err error
 
+	c.Set(BearerAuthScopes, []string{})
+
 	// Parameter object where we will unmarshal all parameters from the context
 	var params GetOffersParams
 
@@ -216,11 +327,19 @@ func (siw *ServerInterfaceWrapper) GetOffers(c *gin.Context) {
 		return
 	}
 
-	// ------------- Optional query parameter "offset" -------------
+	// ------------- Optional query parameter "cursor" -------------
 
-	err = runtime.BindQueryParameter("form", true, false, "offset", c.Request.URL.Query(), &params.Offset)
+	err = runtime.BindQueryParameter("form", true, false, "cursor", c.Request.URL.Query(), &params.Cursor)
 	if err != nil {
-		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter offset: %w", err), http.StatusBadRequest)
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter cursor: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", c.Request.URL.Query(), &params.Sort)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter sort: %w", err), http.StatusBadRequest)
 		return
 	}
 
@@ -240,6 +359,46 @@ func (siw *ServerInterfaceWrapper) GetOffers(c *gin.Context) {
 		return
 	}
 
+	// ------------- Optional query parameter "involvingUserId" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "involvingUserId", c.Request.URL.Query(), &params.InvolvingUserId)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter involvingUserId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "status" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "status", c.Request.URL.Query(), &params.Status)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter status: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "gameId" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "gameId", c.Request.URL.Query(), &params.GameId)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter gameId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "createdAfter" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdAfter", c.Request.URL.Query(), &params.CreatedAfter)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter createdAfter: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// ------------- Optional query parameter "createdBefore" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "createdBefore", c.Request.URL.Query(), &params.CreatedBefore)
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter createdBefore: %w", err), http.StatusBadRequest)
+		return
+	}
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -253,6 +412,8 @@ func (siw *ServerInterfaceWrapper) GetOffers(c *gin.Context) {
 // CreateOffer operation middleware
 func (siw *ServerInterfaceWrapper) CreateOffer(c *gin.Context) {
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -277,6 +438,8 @@ func (siw *ServerInterfaceWrapper) DeleteOffer(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -301,6 +464,8 @@ func (siw *ServerInterfaceWrapper) GetOffer(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -325,6 +490,8 @@ func (siw *ServerInterfaceWrapper) UpdateOffer(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -335,6 +502,84 @@ func (siw *ServerInterfaceWrapper) UpdateOffer(c *gin.Context) {
 	siw.Handler.UpdateOffer(c, offerId)
 }
 
+// CounterOffer operation middleware
+func (siw *ServerInterfaceWrapper) CounterOffer(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "offerId" -------------
+	var offerId OfferId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "offerId", c.Param("offerId"), &offerId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter offerId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.CounterOffer(c, offerId)
+}
+
+// GetOfferEvents operation middleware
+func (siw *ServerInterfaceWrapper) GetOfferEvents(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "offerId" -------------
+	var offerId OfferId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "offerId", c.Param("offerId"), &offerId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter offerId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetOfferEvents(c, offerId)
+}
+
+// GetOfferHistory operation middleware
+func (siw *ServerInterfaceWrapper) GetOfferHistory(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "offerId" -------------
+	var offerId OfferId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "offerId", c.Param("offerId"), &offerId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter offerId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetOfferHistory(c, offerId)
+}
+
 // CreateUser operation middleware
 func (siw *ServerInterfaceWrapper) CreateUser(c *gin.Context) {
 
@@ -362,6 +607,8 @@ func (siw *ServerInterfaceWrapper) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -386,6 +633,8 @@ func (siw *ServerInterfaceWrapper) GetUser(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -410,6 +659,8 @@ func (siw *ServerInterfaceWrapper) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	c.Set(BearerAuthScopes, []string{})
+
 	for _, middleware := range siw.HandlerMiddlewares {
 		middleware(c)
 		if c.IsAborted() {
@@ -420,6 +671,58 @@ func (siw *ServerInterfaceWrapper) UpdateUser(c *gin.Context) {
 	siw.Handler.UpdateUser(c, userId)
 }
 
+// GetPreferences operation middleware
+func (siw *ServerInterfaceWrapper) GetPreferences(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "userId", c.Param("userId"), &userId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter userId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.GetPreferences(c, userId)
+}
+
+// UpdatePreferences operation middleware
+func (siw *ServerInterfaceWrapper) UpdatePreferences(c *gin.Context) {
+
+	var err error
+
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "userId", c.Param("userId"), &userId, runtime.BindStyledParameterOptions{Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandler(c, fmt.Errorf("Invalid format for parameter userId: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	c.Set(BearerAuthScopes, []string{})
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		middleware(c)
+		if c.IsAborted() {
+			return
+		}
+	}
+
+	siw.Handler.UpdatePreferences(c, userId)
+}
+
 // GinServerOptions provides options for the Gin server.
 type GinServerOptions struct {
 	BaseURL      string
@@ -447,6 +750,7 @@ func RegisterHandlersWithOptions(router gin.IRouter, si ServerInterface, options
 		ErrorHandler:       errorHandler,
 	}
 
+	router.POST(options.BaseURL+"/auth/login", wrapper.Login)
 	router.GET(options.BaseURL+"/games", wrapper.GetGames)
 	router.POST(options.BaseURL+"/games", wrapper.CreateGame)
 	router.DELETE(options.BaseURL+"/games/:gameId", wrapper.DeleteGame)
@@ -457,53 +761,111 @@ func RegisterHandlersWithOptions(router gin.IRouter, si ServerInterface, options
 	router.DELETE(options.BaseURL+"/offers/:offerId", wrapper.DeleteOffer)
 	router.GET(options.BaseURL+"/offers/:offerId", wrapper.GetOffer)
 	router.PATCH(options.BaseURL+"/offers/:offerId", wrapper.UpdateOffer)
+	router.POST(options.BaseURL+"/offers/:offerId/counter", wrapper.CounterOffer)
+	router.GET(options.BaseURL+"/offers/:offerId/events", wrapper.GetOfferEvents)
+	router.GET(options.BaseURL+"/offers/:offerId/history", wrapper.GetOfferHistory)
 	router.POST(options.BaseURL+"/users", wrapper.CreateUser)
 	router.DELETE(options.BaseURL+"/users/:userId", wrapper.DeleteUser)
 	router.GET(options.BaseURL+"/users/:userId", wrapper.GetUser)
 	router.PATCH(options.BaseURL+"/users/:userId", wrapper.UpdateUser)
+	router.GET(options.BaseURL+"/users/:userId/preferences", wrapper.GetPreferences)
+	router.PUT(options.BaseURL+"/users/:userId/preferences", wrapper.UpdatePreferences)
 }
 
 // Base64 encoded, gzipped, json marshaled Swagger object
 var swaggerSpec = []string{
 
-	"H4sIAAAAAAAC/+xae28ctxH/KoNtCifI+h6SUsT6K7YsGC6SOPDJKBpHLXi7c3e0d8kNyZV6Fe67F0Ny",
-	"XzruvVUXbf/yaZdLzvzm8ZsZ+iFKZF5IgcLo6PIhKphiORpU9q85y/FtSr9S1IniheFSRJdRwcwC6qVQ",
-	"akzBSEj5bIYKhWHcIOgCEz7jCdAuehDFEa++jeJIsByjy+qEOFL4e8kVptGlUSXGkU4WmDM6Gv/B8iLD",
-	"6PJsFEdmWdBnXBico4pWqzjKeM7NuoxmgSDKfIoK5AwUalmqBDUsZQn3TBhQaEolMB2AXsgyS2GKwEBI",
-	"AQLnzPA7hOoYL/rvJaplI7s7OCjq+LugqJLwOQRQztqA2m36EK3O2AnSP4365NR4CKZGgv7MC5jiTCr0",
-	"EHMxp7VlZvR2rAc9YHuRglqch7XQUplXy3cWQrWujD2gBbqRMOMZ/fLCwnTpoPZ49ohF7z9ov2Z3jL10",
-	"9+Jg2Up7aB9g5QaRLs43iPQeE15wFOaJIFPV/geA5pU6Mn5ol77wqWHbIXqCMK7cp6jNK5lytHn0F2aS",
-	"xRt7ACVcYTy6rCgynjBSYvhJkyYPrXMKJQtUxu+RSJFyp+5D9JXCWXQZ/WHYZO+h+1AP6ZyravG1KPNo",
-	"VWn3GDZ6SpFMcU2ZOIob5aJJWaCCn5jiEl4pqaNaWW0UF3PaVpL76m2Jwq2C+4W0P9P6PJ8n2seO1yGN",
-	"o6KcZlwvQpFSv+rV42faSKQyJL9eaoN5WH73DsyCmUbge6ZBYYaMPEyK7kHXk9AZS2QBuelpW2S7c6VM",
-	"OqzO6EDz4vswrfhHcvoJE0MuuIqdy9nct5fPbXIsu9vEMFNq51bNQRTKR/g2S1OFWneCKxqfncNPjAuY",
-	"GHhZGBjHMGGZgR/ZZ4QrbpYxfLiB7y/G43EURzOpcmaiy+jl69fvrycT+PHtz9cwhs6fZzFcvb35awyT",
-	"m5c31/Dr21+u3r2+DhmtipdGnD/LhYDXEkOrC6b1vVRp94v66doXfTaT2vw/S/xvZok+ZnPPK7EtRn06",
-	"hOjo35F+Gqb82NCncMI1NvGS1GjGLV+97Y+H/VNYNyB8NfKmp5Mh/b0uoLBQqKlaEPO289k/FUsxpfLG",
-	"msHXlPHm5iR+VB7ud7o9EhKFzEj1TEMN7RaD1/XVsTr7MgZr71PoC8O23uONMhyhucIE+R32qH6x1RUf",
-	"l+brdWfXN9aR2+CW/3WEhznjWVeeT3IhUok/zOnVIJEUswUzBhVZ8G8fXz7/lT3/5+j5i8Hf//jt89tv",
-	"f2g9eX777W+/DfyD24ez+LvVV1+EZ9se4XSsc1NlhNa+QYuvquLf2mudOEkY++/HKOc2OuZSkjQzxilH",
-	"FFIq2rmR2C9b04/2fo+6kELjqbm9meVsyVnrJtmP4784SR/MtQtmUDINGRefqX0kGWhtVZPosFS2nRxe",
-	"nG8q/vdj0Xoqdio6da41QaaSRdvBuMFc7+JO9UdN6cqUYkv621J0v9u2hl4b2/t4G1eHzNOiK/d1zdGO",
-	"RLjt/WWHqi28eng2CvrxZsbe6CJccDtpSBsBdnaUray9RfuGrDv619uGABhvFOQwCPQja2xE4iIYyLbD",
-	"3L8ZDbB/m+WPqANqmUKB5QQ5LLK6kdMXWi0tW1RToEgJsThKmEgwy9CJTnLZnyxJsKCfHeppPlsDnvDo",
-	"D+MTlCyHFh1HVg1Nut82AA12Mj1VQ6hUiCMuZpJOMty4SJPTUhubr+9QaRdB48FoMLLJpkDBCh5dRueD",
-	"0eDM1VcLi/HQxqi9hHGTeLKFLS5JlegNWud0xUtzZfMx7G/NkqG7tFjFWxf6gfsOK9uT7NUtoeh8yEp/",
-	"NhqdbAAV4DALejc/TcokQa1nZZYtYSZLkbobKDfiLvOcqaVDEPIyM7zI0C+II8PmuiJgHd1SvSJ1YBB+",
-	"UyVfroGVRubM8ITRgUxrPhfATTc1crOAnJlkQbmxGdx3jXpFvR6+cX7WDJGXfbh05szDenq0WjPB+KQm",
-	"2Bl827uig/8R+k5VYFU19Rj4VewjYPjgiqGVM0KGJjCheplpCe6lBpZl/obMTWVy6iwlmWQAf+FZ5m+l",
-	"4N7wBTw7G108A7xDAdwWncraVMjGWnUx1jXWa3ucN9Z+Meh3DMTKxbpuHUSdjqlzqpQZNniEq5PK+Sa9",
-	"D/r0poxyQmVGX8brFBrF8c77nUOhC9J7v2ILTAV5wLpBPhQpuS7RQVyPzFQMVI/Hfh4YQ12Nx8BEOpTK",
-	"zzcHPvrJy3iel4ZNM6QlcE++OUXgcyGpcuIz4CLJyhRTlz98uMNUpsv15OHEOt6E+2ad+mprtbc3l1bk",
-	"fjt5pLXszp/7LEY5wwX+Jtp851b85/CmnyXu/EFzP/ukMReqa0/EtrIyQWVB/6Cfbyu6EO5by622v2F+",
-	"ek3xwYSkBG4DrE71JLmPn4vRC5/knYiQSvHMwBQzKeYVXbOCyl5lL4zre+IQTbvB9IE87T5+SqJ+1Frs",
-	"yNTSyRWkao99yGxN5A0ffOO1ka87NEymOZaGK2PsF9NVj3gEETt3DOQuT8St90F335ilTqnQ6At5VsPG",
-	"vVARHSO/2w5WDyFfMeGpxEaw69XrGzO750zJHHzrS5Fet8wxVB1zDFJB3TOH2fUUVjmEX/vSxa4E6yFh",
-	"VXKGr/ms1vWbAe18MXqxl4c0rfdNp8nx1c3FOaQSKYINFT6te0Za5GIZzkYDsKpVAmo0HesMAiP9NXe7",
-	"sdninpF+wLUu/SGN9b/mXkIhgXI9KjfNJTG+CdccPY7Ul/wsU9iZiaevEGPYO6MDCcN++5R80Rn+7EoX",
-	"pe5lC/eugcsh1EJr+OBcZffGzrmu7emYQv+fBPy0s8P5e/FKXzPuEri32X4B70dHT9jf1e8DCPeTyomV",
-	"GX0Z52sYpUGhp7/bDNP2/q5q3fzMbwDXOePZE7Vux1vnEGrpSSy7MkufCQKt2yZjrFarfwUAAP//DGFs",
-	"IIouAAA=",
+	"H4sIAAAAAAAC/+w9C2/bOJp/hdDtobtYxbHTdDANMLht0043RV/bpDM37eQOtPTZZiORKknF8RT574eP",
+	"D4myJVt23MfcHTBAxhJFfi9+b7Kfo0TkheDAtYpOPkcFlTQHDdL8SiRQDemjiQaJv1NQiWSFZoJHJ9Gn",
+	"EuSCVF8QLciEZfh/otRETCYgFXFTkDFMhASiZ0A0y2EQxRGrJoniiNMcopPminGkkhnkFJeGG5oXGQ45",
+	"Gh4dHwzvHwxHF8PhifnvfRRHEyFzqqOTKKUaDnCNKI70osBPlJaMT6Pb29gv8NiAc0ecqCZCEjoxA/sh",
+	"5tZdh9nxrpiVUokWNomCfiqB2NdE0yvgZCJFbkDmcGOQKCRck4zxKyImhJqfTJSKFHQKA/KaZwtyTTOW",
+	"kjnTM/OlElITpsmcKsKUKiElEyE70bfAteMNi+d/nH0UbJz/rN+fn6kz/ht7zZ7T97/eXP2Gv/Mr9vrj",
+	"2Xzyr1bE4SbJyhTeKZBnaS+WZkCvwXB0SnNQRMw5iujCIFYqkDGBwXSAQ2csBbIQpcRBbvh8xjIgmRBX",
+	"jE8Ra6IlTUF1Id8EsJUGx/crzBjXMAVpUMP1TgVPmcWlv7RaQMcLkvivB+QtFEANz7QgOdXJjFC+QIYr",
+	"uAZJs3qwQQVuikykEJ1oWUIHWyvYWrH6EOWM6yiOpkKk0WUcMQ250Sx/kTCJTqJ/O6zVz6GdQB0+C5F+",
+	"yss8uq2IQ6WkC/yt9AJXMJsjcpRq435B9SygUKkgRfRThlsZuKZMA1EFJGzCEku2io34bY2rWyGOJHwq",
+	"mYTUE6YF8aNhJztfmdm25eR8JhQQhASZpCnjygjrNc1KiAmbcoH7gSRUdaog86d9B+ZUMtG6uXD5N+U4",
+	"Y2q2nQ2oJLDwX/cEsxrfAesrpChPu8H9l5mvD6gKqExmBlRDW0UoT2uADfhzIZ3Wo2RSZtmBRpVpvxyQ",
+	"l7iN8DsJ/J4mkvIrq0kkZHBNedKJ5qcO9FRZgCTrGXIupF5FEOVByNSiJkGX0issxgfkjYQJu7GY3Du4",
+	"Z9QWfg88RY6YDwfkmRmvZ1QTzQDRsm8sUnYLdGGEFqGBVAoTWmY6MOv4HnBHn3zw4njg/i6AIscP3N9Q",
+	"sxyEP8KpDuofl520WigN+U6Sq8ynfRSnHdlXa9rRXSrz1dPzKI7O8U+oMZew26wRGb8W2TXj0y0Mo/d1",
+	"rJ/jrSFhigDTM+fmmLc4yv6UkLCCAUf3qEs0lmFpRf2HdqWZsZx1SDsv87EBl0hQopQJKLTVZE65djsA",
+	"0piMQc8BOBmZ7T0aDgfkiRVNhUgfDbvAtku3Ajt6EEc5vWE5CvNoOIzR1LlfrWjk9OY3oFu70VYYJWRA",
+	"0XTVzibuky64/VrtkD98+KAdQsb3AGHg6K8FkfF1IP7YDqIRvWcdpr6HPOMu5sYZMwAi6DER3Eu3Ymmn",
+	"vq7Mf39zb5bdxSlhNHRKLPQdXolfo5db8sMaOPvbFEfN/kbldUD+FqviUNiTWdnGPljENdWl2kGc0EKY",
+	"b3tZCDMSepsIC1SHiSgsfXt71K9rPPv600j1x4vXVtVvQxwJyihWz1gnnW1Iuvc72AQH3ZzvDFup1slc",
+	"uX2oZkF6643hjmBVxrSTaNWIHchWqn3oI5ylSx2Vqr82aiXkrf0UlH4sUgZGtN/ghnrm4iYMfxx9aVFk",
+	"LKGIxOFHZQPkep1CigKkdnMkYRS9dfTJW4M2fIp73JuSKK6Ri86NH/8S/XjyWAq16szHEeYdpNrk29hR",
+	"GAK6RIVfz9nacNkW3yMOIqpVzvtXnXh0h1uxd2Rb4bfvnNL3AM9p4CkI3lzo6XnbGotWlwSfhiCbmT0y",
+	"6aFfI4p7OBXukRh/hESjCN7GVuSM9ttK5rZSwvVCuJXvINs0TSUo1YwjR0f3yUvKODnX5FGhySgm5zTT",
+	"5AW9AnLK9CIm7y7Ij8ej0SjMMT568uTt0/Nz8uLs1VMyIo2fRzE5Pbv4LSbnF48unpL3Z29OXz952sY0",
+	"v19qcJ6LGSdPBLSNLqhSGGY3v6ietlnuVp4JpU9FyTXI7Tm3KsA+dDYylth5D4zJijEDmMwIUySnKfjE",
+	"YRgIEes4sSnjNLOGEDUq08r+ABnFS1yEm4JJUI9aTMd8Bi1gEPcFYRPC9D1FlGZZRpxzMCAvS6XJGDwK",
+	"k1KXEpqhDz5XIK9B3nOAkYxNQLMcglCjuarDOiACJXOAK1LyDJTC/NSETUuJO1zPQM6ZzfW0ZPB/vBgd",
+	"bZfnjr3TYIMA1c26s1SFCiKIZh066KBW4SyZsmtQpCxCQD8cjeKj+y1BeKBbc3pzZt+ObAzofy25WHFU",
+	"cvapBPcajaIxdU5ktkfHWUlI/WODGxoJI5Or8tfEbPjl0LoNrf+HZYa1IH3ZvZ//3+r/37T6XZ6qfV4p",
+	"WKRRFw5t7uXXcCdC2a/cYZfkDHPbLtFZJQNrWV2zH16IKeN32BCQU5Y17exHMeOpgH9M8dUgEfmeTHRI",
+	"B7tsMM0aFLe33dvb0a9rP//cdnMMxlJKmtY10tqHCU1KfHT0JY1lM13QioBbi0goJCjg2ht5A74t3Avk",
+	"VbUxN6iLOxhoS7cVM13NuORpfBU34w60k5AAu4YO4h1vVIXLyZ7VPMadHIX/dSFUT01dUK1BIg//68Oj",
+	"g/f04I/hwcPBf//73w8u//6P4MnB5d9//33gHlx+Poof3P7lm0RubWbBWUfPhB52otSYegYJPAG1Fd/X",
+	"eYGvhGYT92k4/+2tS0ypQnBlF/xZyDFLU2hpy7iYAaGlnuEeSkynkK+icaEJzTIxtwm2XKRsghqVqaqC",
+	"hWR9JfTPouRp69QS7EzVF3VPDgYxnLAU53jHEQQh2R/QPo9XTcYwMaVwu1PX5UOTBBRauCvghmuOQjjR",
+	"qquMzHfZ97DfI44mlJk4VwiJnKwlxA1bkSec+62j8r69+bpDZG3dpm0LbOfVf3O3fGfvekY1CKpsI5hz",
+	"b6qwUsy5aocKh6jD4/vr0nfb+c1VsW1fDrQVrXPTtREKWBN/wcF0vCH9jRGPvfMXmHGZtiRvUqqNdund",
+	"4FQB0VKLQfJvnOQNncILM/A2jq5BqtYOMfeidj7sqsQaqwH5xb0fmYiHkjGVQAwgFQ0aPujRRtZ5UGJL",
+	"E49NG0tMMNO93a0SujA6aAUxxaYmKMa3tpWHp55Zj5ziM3qczICmIAlV5N5joBIk+b0cDu8nwfTmAdxr",
+	"CDUsns/GzxJsRDx798fZ6BXDxsS3D5LTsx/Oror//OX0+cMBdi6mv56x1+xs+HLx/OEAwaK6lK3W0sUb",
+	"Zy3o1HG/ApRjRUquWWbQCZWxj1lCUO//MGzVY+aDC/M41AmWCF1qYZPYoZ9Vy+4S70OOheuHqLtl2uQh",
+	"NL+nM8o5ZMv2ReW6iOJoDuOZEFdRHE1YBk3b4oasYBfO/gQy9GUXfvqVMNG0A/DgC9PihVKmUZL0DBZk",
+	"RosCOBGYUcwySFA7MK4FoSSlLFvgGwzwsgVJ2RRUWKVmeQ4poxrMPmHZwiCFY5vIhOPWYvT0Grheppbx",
+	"qAeuCO497AFyqQgfSPgISfggoTyBLAuf2Jxp8MRy1OvoYBHzsyxS87OBzDI4axFa8u+WPAErHR3hmH8b",
+	"pHwpx0jeMhSV+PVS8Gqlpm89vUtQW3R56iRtmykb0onBX6khNQzuQBjMuxrdVIDCdkTTB6VFA3U6FmUz",
+	"9lziyy5EqKVvhQRLKqLiXBOtgFBtmsHkhMzQdqONs04BUaWuP8Wkc2xzxoWnkE1LOjyDzMyMGn/aNMW7",
+	"j1YMPE20kO928JtU7WhbKIOVB+Slc7wnQrrXKkgq2VS+4LZuNOcxydgVWBuwGLT5YMdt2woR26FFRCRJ",
+	"KaXpnuk6gLF9GkoCVW2Oyny2WEHc7+WpSZoBd8cNULIVy4tsQeY+z2zYQ6i6sscQGqTBxFrGEn0SVOi4",
+	"IJngU5DWrTU536NRG8BabF/YbYq8FlGDmOsFXHW7p4Y+Zp1KVsSkkviYiCwFpcmESaVXBHgrD7UGZ+OG",
+	"NvN2ovRPprSQi/U4VQ1lhBIOU6GZUSpNhAbkKaoHO5iMS8v3jCojE6QyUFWKkvsULNODPVCj22HfiiDd",
+	"7u6e8tZ7zhifpRsbizbnlkP9WOXNwyypnaDinc04MtN4JJYMtfns8GgYxf5/j7brk96QRl4bAzPOECZI",
+	"azB7R8IFlcBtdaPvupbdJj1krJyVcVWbDVc6aBQZaLNe3zQT5pE6fPCwXTdvSnZvZGQdJzdY2Z709gwc",
+	"bcfAjdns9Sxclrm1nGy1p6rqGL2LWag7d/eRGo/rltFakXRqoW0SIVZkvkwmZINm/Y5SIXUT9pfJhSxL",
+	"SxDF1Yo9jMuCoC0I6MI4zUdojRisnmxFrGsy9tv3HNh0NhYlfm+kxboj7mxUHBwVpTm4XlcV24OjeBDD",
+	"nK6odZk3clV+W5XJzB5AXREyPLbadEoPjS75DzPnT6MHmNE5+gGX+onTHOxPewj1p7scN0VA4HrfSz9+",
+	"/8/32Zi/HSX5O/bi9Hlx9lEMX5w+Z2cfi2HCf8k6Tr6uSNE7tc7D2EORa9cy1R3rTHXCelMbdmv3RUed",
+	"qaW4FEcKklIyvThH5WLpNjYZM8wq1r9+9i7U818vfA82zjReyq7NtC5sWzPjExNKaKYNvlMxLpU95l7p",
+	"rGg0GA6GxkspgNOCRSfR/cFwcGQrfTMDziEWdg4z3wlSCNXiMv4CEuP9Oilwz5xbT003d2YPOppj26jq",
+	"XDK1kWj0OVWrCw1W7g3qUJMfc6ZADcijxCieleP+vo6nyBwkYKA9w3UkEAkH7pcwu55J6+bjrkcoJmVG",
+	"DIq4+VGITUiAMmDTxlHYJ96ZXWm0kh/WDTTLxbyj4XBvRcRmVtuwvsma8wrDbIE4Tk3eEGE6Ho7aS3VG",
+	"gM05fUdQVJGMJ0LKZbmNTj5cxpEq85zKhaUWmm6jjO00yPqwREunyiRvUb4vcSqr0BCSKRhiNOn/DIzX",
+	"Yeu09XURH9rJUg85NBoyuo03DrTass/I6jRsj7HhoZGeU5vD2j3H2mPHfWG2Raueo+srAHp+UJ/Y7vGB",
+	"P4rXZyi96Tu0eenB7eUX3HEtpb1N226C5XUbuazdPc9Ak7zMNCsyF+gEO8b+vryNO3Twhe8mxKis1CKn",
+	"2A+Ay1OFKtedF6vDE9yj5vSYie2qE0rN7XdqVOwza8p20oHPrFQvM2S0V4b0ZoU3GVMHlVOC7ag4gA8b",
+	"3Q3mo/ubP6pbNm5vQyZbihLqK9vL/K1U4uFnW5i+tbzOQLfETuaylLo7NacLYoe6BQbkV0zXWLDc1QLH",
+	"w2PCJg3vt5KD+tB9Uw6emEmdHGyniO2UbZvyeBWfBrMsJpZZBIOawVdjGX5xvPmLqnemyWNLrRru1m28",
+	"ztztkcjDb7PRJGjJ4Drk3lrd99aN30C0AgV1VWzemQqguVYjDu8AWQCVsesTj+sbZ2J0Sw6FtLtGDZz6",
+	"M35OnpeajjPAIWSOm2cM9i4R9Jwm/ki320u+2jIW6WJ111iw7s7QbdVudYTxdus952qpIde+hZZ0DFWi",
+	"efyhSzBQadqkyTpH0h4N/x48yfoQfH9X0nVB9/6gPh3c45PlOzN642DzgH2Hu9sU+tAyvJut/3h35dkX",
+	"1YNtSc2tXMCdNtRtp6covFj7XeEedPuK3gfh9WFBmzoXHIiQJBfSZ9rtZUTcxuDGcZwI2RhntydDNRre",
+	"vWA6WMJaUZVzW7iakhmSU4llVKrcw7TdY3mIqtfdclCXAVKB5dkxYHXVO7e0wDyUNKfIEV4VEyFj5/D4",
+	"iq9AtykDrZyb5E5eIFoeWksZRMRctRe3AoAY0EwCTRe2otj4usudfu1OyO3kT9uPv6RDvZQn7+lRCw/X",
+	"t3OpeXX2cGUn1Abi8LOrhaz1q09N8lutcNSLODKeA4qShFxcQxoTJVxqyVXNZ7YaTZgiV1Bod7FheKdR",
+	"6K1zv8B2/rrDJSa0Hv3Qja6rdHUDgj9v1OHge8nczkA6IHZx8asiQw3w9+vj4wcP2yPvblK3hwZ2/JI3",
+	"E+jttS7MPhk0/EZqo44PAlLswTJiHIFHhzZSuCOSOKXc+cAk6IAR4YYyrVteLWhRy3BMfJ0sNne1ukpZ",
+	"x863n9WP7R4WfmjdPoSD7Vw4q10C+0wwEQ6FOTlVWfLE6S2w7SvGajctWngvlfIWjWnl+q/dpE1kAgzr",
+	"1heE1tlsImqtODGHwPFlQq119q1oFkHurr/CLskGZIoUVGmnQ13XWahu65X1TIpyOiNvXp9fkBW1fugG",
+	"xuYADN6bBNofL6u0cxyAXxcFxJx3BXH72Hi7hHFd5r5vHOcEmHrvk/wV/RjH478N/gTKtrdyqqt7F40k",
+	"pwvuj++bVlUjFXi9bn38GgfZeBuv57My5wmnQDf2+KClNnobtx6cMpV9bgtfdX3a7sK/MgdhS29g7C87",
+	"7DYqf2sPlzs0Vl+HyO+c7kKfVe+pqcovuUb+2lIOcyI4xFZNomKpNVnzUpLYBB04QXX3k1dCF6sXmjAV",
+	"xApNLWT7A+bVmWhsGxjT5MquF6jfpk51k2zwvXp4U/GfMThxxkHPKK9aGG2vUkXclvglvPHm6yrD5ft2",
+	"vr8IaOX2mq+qXHfVlZXfgHrRtbabreuNhFF/QadPH+23drP4/EF9k4yqDhGgYnZS33YZ0nLgt7SDeys6",
+	"qM43OEd7Wc3pUnLvRdX9/pUaqBr+m23DMT6Vxtkw2oP5JgW8Ej2KO9z56lTC9+rUL7WK93ftV+nliKn2",
+	"5erjOlazlinTaFCwdWGyvUS4aL2nSDjx5v7UAKrnSVNUw0ZZawTQasb1v4ZgJCZIwJkGc22Obiy31LbL",
+	"jWt3/44FZ7khfzvJCbrz9y4uwdx18MQwBJHIky6xMcoqdI/a0nvmdogdTdw79YVN29KRyn6WrVQg11bv",
+	"qqJ2qRp7rlRLtDv8XKqNybdHmRIuMaaq+9RcSnnlX8+ovDbcn+5y4KPh8T1zCqszb9bV72DTM46D222r",
+	"Uu2aBPN1bnuc7qvWudtyUxUYLYzszkztmWbDbyPxtQaqqbBP3bOetpur275w7bpKB+Sp6bL7MoXru7N0",
+	"l4xHhwrsm/C4K9/2X7hex/NVxXhYNM8it3oj75S/rm9Gr30lwqQqTB4rmIJM7VPiLjJX/kowKiHwbzlk",
+	"sVGQJdLQHfE1bbv+TDjxZ2aDeNpghqG0AqhTaOHyrd5LeNr6e9QYa27m6ak8wsP8ITm+jUw2PB/Xnt0J",
+	"YateKlt0vpX0vfFyW1XRvJRpd33xvbGqyGiyK6eWXLTmYYIPl7eXt/8zAMbjueqDbwAA",
 }
 
 // GetSwagger returns the content of the embedded swagger specification file
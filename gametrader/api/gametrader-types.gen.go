@@ -3,6 +3,14 @@
 // Code generated by github.com/deepmap/oapi-codegen/v2 version v2.1.0 DO NOT EDIT.
 package api
 
+import (
+	"time"
+)
+
+const (
+	BearerAuthScopes = "bearerAuth.Scopes"
+)
+
 // Defines values for GameConditionEnum.
 const (
 	Fair GameConditionEnum = "fair"
@@ -11,14 +19,78 @@ const (
 	Poor GameConditionEnum = "poor"
 )
 
+// Defines values for NotificationChannelEnum.
+const (
+	File    NotificationChannelEnum = "file"
+	Smtp    NotificationChannelEnum = "smtp"
+	Webhook NotificationChannelEnum = "webhook"
+)
+
+// Defines values for NotificationDeliveryEnum.
+const (
+	Daily     NotificationDeliveryEnum = "daily"
+	Immediate NotificationDeliveryEnum = "immediate"
+	Weekly    NotificationDeliveryEnum = "weekly"
+)
+
+// Defines values for NotificationEventEnum.
+const (
+	OfferAccepted  NotificationEventEnum = "offer.accepted"
+	OfferCancelled NotificationEventEnum = "offer.cancelled"
+	OfferCountered NotificationEventEnum = "offer.countered"
+	OfferCreated   NotificationEventEnum = "offer.created"
+	OfferExpired   NotificationEventEnum = "offer.expired"
+	OfferRejected  NotificationEventEnum = "offer.rejected"
+	UserCreated    NotificationEventEnum = "user.created"
+	UserUpdated    NotificationEventEnum = "user.updated"
+)
+
 // Defines values for OfferStatusEnum.
 const (
 	Accepted  OfferStatusEnum = "accepted"
 	Cancelled OfferStatusEnum = "cancelled"
+	Countered OfferStatusEnum = "countered"
+	Expired   OfferStatusEnum = "expired"
 	Pending   OfferStatusEnum = "pending"
 	Rejected  OfferStatusEnum = "rejected"
 )
 
+// Defines values for GameSort.
+const (
+	GameSortCondition      GameSort = "condition"
+	GameSortCreatedAt      GameSort = "createdAt"
+	GameSortMinusCondition GameSort = "-condition"
+	GameSortMinusCreatedAt GameSort = "-createdAt"
+	GameSortMinusName      GameSort = "-name"
+	GameSortMinusYear      GameSort = "-year"
+	GameSortName           GameSort = "name"
+	GameSortYear           GameSort = "year"
+)
+
+// Defines values for OfferSort.
+const (
+	OfferSortCreatedAt      OfferSort = "createdAt"
+	OfferSortMinusCreatedAt OfferSort = "-createdAt"
+)
+
+// Defines values for GetGamesParamsSort.
+const (
+	GetGamesParamsSortCondition      GetGamesParamsSort = "condition"
+	GetGamesParamsSortCreatedAt      GetGamesParamsSort = "createdAt"
+	GetGamesParamsSortMinusCondition GetGamesParamsSort = "-condition"
+	GetGamesParamsSortMinusCreatedAt GetGamesParamsSort = "-createdAt"
+	GetGamesParamsSortMinusName      GetGamesParamsSort = "-name"
+	GetGamesParamsSortMinusYear      GetGamesParamsSort = "-year"
+	GetGamesParamsSortName           GetGamesParamsSort = "name"
+	GetGamesParamsSortYear           GetGamesParamsSort = "year"
+)
+
+// Defines values for GetOffersParamsSort.
+const (
+	GetOffersParamsSortCreatedAt      GetOffersParamsSort = "createdAt"
+	GetOffersParamsSortMinusCreatedAt GetOffersParamsSort = "-createdAt"
+)
+
 // GameConditionEnum defines model for GameConditionEnum.
 type GameConditionEnum string
 
@@ -38,33 +110,114 @@ type GameResponse struct {
 	Year   int    `json:"year"`
 }
 
-// GameSearchResponse defines model for GameSearchResponse.
-type GameSearchResponse = []GameResponse
+// GameSearchResponse one page of games, in the requested order
+type GameSearchResponse struct {
+	Data []GameResponse `json:"data"`
+
+	// Links hateoas links to the neighbouring pages of a search, with the same filters, sort and limit. Missing when there is no such page.
+	Links PageLinks `json:"links"`
+
+	// Version version of the response format. Version 1 was a bare array of games.
+	Version int `json:"version"`
+}
+
+// LoginResponse defines model for LoginResponse.
+type LoginResponse struct {
+	// AccessToken signed token to send in the Authorization header as 'Bearer <accessToken>'
+	AccessToken string `json:"accessToken"`
+
+	// ExpiresIn number of seconds until the access token expires
+	ExpiresIn int          `json:"expiresIn"`
+	TokenType string       `json:"tokenType"`
+	User      UserResponse `json:"user"`
+}
+
+// NotificationChannelEnum defines model for NotificationChannelEnum.
+type NotificationChannelEnum string
+
+// NotificationDeliveryEnum whether notifications are sent as they happen or collected into a daily or weekly digest
+type NotificationDeliveryEnum string
+
+// NotificationEventEnum defines model for NotificationEventEnum.
+type NotificationEventEnum string
+
+// NotificationPreferences defines model for NotificationPreferences.
+type NotificationPreferences struct {
+	// Channels the channels the user can be notified over
+	Channels []NotificationChannelEnum `json:"channels"`
+
+	// Delivery whether notifications are sent as they happen or collected into a daily or weekly digest
+	Delivery NotificationDeliveryEnum `json:"delivery"`
+
+	// MutedEvents the events the user doesn't want to be notified about
+	MutedEvents []NotificationEventEnum `json:"mutedEvents"`
+}
+
+// OfferEvent one change to an offer's status. The event that created the offer has no from status.
+type OfferEvent struct {
+	// ActorUserId hateoas link to the user whose request changed the offer. Missing for changes the server made on its own, like expiry.
+	ActorUserId *string          `json:"actorUserId,omitempty"`
+	From        *OfferStatusEnum `json:"from,omitempty"`
+	OccurredAt  time.Time        `json:"occurredAt"`
+
+	// Reason why the server made the change, when it wasn't simply what the actor asked for
+	Reason *string         `json:"reason,omitempty"`
+	To     OfferStatusEnum `json:"to"`
+}
+
+// OfferEventsResponse the status changes of an offer, oldest first
+type OfferEventsResponse struct {
+	Data []OfferEvent `json:"data"`
+}
+
+// OfferHistoryResponse the offers in a negotiation, oldest first. Every offer but the last was countered by the one after it.
+type OfferHistoryResponse struct {
+	Data []OfferResponse `json:"data"`
+}
 
 // OfferResponse defines model for OfferResponse.
 type OfferResponse struct {
-	OfferId int `json:"offerId"`
+	// ExpiresAt when the offer expires if it's still pending
+	ExpiresAt time.Time `json:"expiresAt"`
+	OfferId   int       `json:"offerId"`
 
-	// OffererGameId hateoas link to the game being offered by the trade intiator
-	OffererGameId string `json:"offererGameId"`
+	// OffererGameIds hateoas links to the games being offered by the trade intiator
+	OffererGameIds []string `json:"offererGameIds"`
 
 	// OffererUserId hateoas link to the user who initiated the trade
 	OffererUserId string `json:"offererUserId"`
 
-	// RecipientGameId hateoas link to the game being requested by the trade recipient
-	RecipientGameId string `json:"recipientGameId"`
+	// ParentOfferId hateoas link to the offer this one counters. Missing unless the offer is a counter-offer.
+	ParentOfferId *string `json:"parentOfferId,omitempty"`
+
+	// RecipientGameIds hateoas links to the games being requested by the trade recipient
+	RecipientGameIds []string `json:"recipientGameIds"`
 
 	// RecipientUserId hateoas link to the user who is being offered the trade
 	RecipientUserId string          `json:"recipientUserId"`
 	Status          OfferStatusEnum `json:"status"`
 }
 
-// OfferSearchResponse defines model for OfferSearchResponse.
-type OfferSearchResponse = []OfferResponse
+// OfferSearchResponse one page of offers, in the requested order
+type OfferSearchResponse struct {
+	Data []OfferResponse `json:"data"`
+
+	// Links hateoas links to the neighbouring pages of a search, with the same filters, sort and limit. Missing when there is no such page.
+	Links PageLinks `json:"links"`
+
+	// Version version of the response format. Version 1 was a bare array of offers.
+	Version int `json:"version"`
+}
 
 // OfferStatusEnum defines model for OfferStatusEnum.
 type OfferStatusEnum string
 
+// PageLinks hateoas links to the neighbouring pages of a search, with the same filters, sort and limit. Missing when there is no such page.
+type PageLinks struct {
+	Next *string `json:"next,omitempty"`
+	Prev *string `json:"prev,omitempty"`
+}
+
 // UserResponse defines model for UserResponse.
 type UserResponse struct {
 	Address string `json:"address"`
@@ -73,17 +226,62 @@ type UserResponse struct {
 	UserId  int    `json:"userId"`
 }
 
+// CreatedAfter defines model for createdAfter.
+type CreatedAfter = time.Time
+
+// CreatedBefore defines model for createdBefore.
+type CreatedBefore = time.Time
+
+// Cursor defines model for cursor.
+type Cursor = string
+
+// ExcludeUserId defines model for excludeUserId.
+type ExcludeUserId = int
+
+// GameCondition defines model for gameCondition.
+type GameCondition = []GameConditionEnum
+
 // GameId defines model for gameId.
 type GameId = int
 
+// GameName defines model for gameName.
+type GameName = string
+
+// GamePublisher defines model for gamePublisher.
+type GamePublisher = string
+
+// GameQuery defines model for gameQuery.
+type GameQuery = string
+
+// GameSort defines model for gameSort.
+type GameSort string
+
+// GameSystem defines model for gameSystem.
+type GameSystem = []string
+
+// InvolvingUserId defines model for involvingUserId.
+type InvolvingUserId = int
+
 // Limit defines model for limit.
 type Limit = int
 
+// MaxYear defines model for maxYear.
+type MaxYear = int
+
+// MinYear defines model for minYear.
+type MinYear = int
+
+// OfferGameId defines model for offerGameId.
+type OfferGameId = int
+
 // OfferId defines model for offerId.
 type OfferId = int
 
-// Offset defines model for offset.
-type Offset = int
+// OfferSort defines model for offerSort.
+type OfferSort string
+
+// OfferStatus defines model for offerStatus.
+type OfferStatus = []OfferStatusEnum
 
 // SortByOfferer defines model for sortByOfferer.
 type SortByOfferer = int
@@ -127,6 +325,18 @@ type PatchUser struct {
 	Password *string `json:"password,omitempty"`
 }
 
+// PostCounterOffer the games in the counter-offer, which is made by the recipient of the original offer to its offerer
+type PostCounterOffer struct {
+	// ExpiresAt when the counter-offer expires if it's still pending. Must be in the future. Defaults to the server's offer lifetime after the counter-offer is made, which is a week unless configured otherwise.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// OffererGameIds the gameIds of the games the user countering the offer gives up
+	OffererGameIds []int `json:"offererGameIds"`
+
+	// RecipientGameIds the gameIds of the games requested of the user who made the original offer
+	RecipientGameIds []int `json:"recipientGameIds"`
+}
+
 // PostGame defines model for PostGame.
 type PostGame struct {
 	Condition GameConditionEnum `json:"condition"`
@@ -150,16 +360,25 @@ type PostGame struct {
 	Year int `json:"year"`
 }
 
+// PostLogin defines model for PostLogin.
+type PostLogin struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 // PostOffer defines model for PostOffer.
 type PostOffer struct {
-	// OffererGameId the integer representing the game being traded by the offerer
-	OffererGameId int `json:"offererGameId"`
+	// ExpiresAt when the offer expires if it's still pending. Must be in the future. Defaults to the server's offer lifetime after the offer is made, which is a week unless configured otherwise.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// OffererGameIds the gameIds of the games being traded by the offerer
+	OffererGameIds []int `json:"offererGameIds"`
 
 	// OffererUserId the integer representing the trade creator's userId
 	OffererUserId int `json:"offererUserId"`
 
-	// RecipientGameId the integer representing the game being requested of the reipient
-	RecipientGameId int `json:"recipientGameId"`
+	// RecipientGameIds the gameIds of the games being requested of the recipient
+	RecipientGameIds []int `json:"recipientGameIds"`
 
 	// RecipientUserId the integer representing the trade receiver's userId
 	RecipientUserId int `json:"recipientUserId"`
@@ -173,18 +392,57 @@ type PostUser struct {
 	Password string `json:"password"`
 }
 
+// PutPreferences defines model for PutPreferences.
+type PutPreferences = NotificationPreferences
+
+// LoginJSONBody defines parameters for Login.
+type LoginJSONBody struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
 // GetGamesParams defines parameters for GetGames.
 type GetGamesParams struct {
-	// Limit the number of resources you want returned. should be a non negative integer
+	// Limit the number of resources you want returned, between 1 and 100. Defaults to 20.
 	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
 
-	// Offset the number of resources you want to skip before returning results. should be a non negative integer.
-	Offset *Offset `form:"offset,omitempty" json:"offset,omitempty"`
+	// Cursor opaque cursor taken from the next or prev link of a previous page. Only valid with the sort it was issued for.
+	Cursor *Cursor `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Sort the order to return games in. Prefix with '-' for descending order. Games that tie are ordered by gameId.
+	Sort *GetGamesParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
 
 	// UserId query parameter to filter results by userId.
 	UserId *SortByOwner `form:"userId,omitempty" json:"userId,omitempty"`
+
+	// Name query parameter to filter games whose name contains the value, ignoring case.
+	Name *GameName `form:"name,omitempty" json:"name,omitempty"`
+
+	// Q query parameter to search game names and publishers by word with a full-text search. Matches aren't ranked by relevance.
+	Q *GameQuery `form:"q,omitempty" json:"q,omitempty"`
+
+	// System query parameter to filter games by system. Repeat it to match any of several systems.
+	System *GameSystem `form:"system,omitempty" json:"system,omitempty"`
+
+	// Condition query parameter to filter games by condition. Repeat it to match any of several conditions.
+	Condition *GameCondition `form:"condition,omitempty" json:"condition,omitempty"`
+
+	// Publisher query parameter to filter games by publisher, ignoring case.
+	Publisher *GamePublisher `form:"publisher,omitempty" json:"publisher,omitempty"`
+
+	// MinYear query parameter to filter out games released before the year.
+	MinYear *MinYear `form:"minYear,omitempty" json:"minYear,omitempty"`
+
+	// MaxYear query parameter to filter out games released after the year.
+	MaxYear *MaxYear `form:"maxYear,omitempty" json:"maxYear,omitempty"`
+
+	// ExcludeUserId query parameter to leave out games owned by the user, e.g. to hide your own games while looking for trades.
+	ExcludeUserId *ExcludeUserId `form:"excludeUserId,omitempty" json:"excludeUserId,omitempty"`
 }
 
+// GetGamesParamsSort defines parameters for GetGames.
+type GetGamesParamsSort string
+
 // CreateGameJSONBody defines parameters for CreateGame.
 type CreateGameJSONBody struct {
 	Condition GameConditionEnum `json:"condition"`
@@ -230,34 +488,70 @@ type UpdateGameJSONBody struct {
 
 // GetOffersParams defines parameters for GetOffers.
 type GetOffersParams struct {
-	// Limit the number of resources you want returned. should be a non negative integer
+	// Limit the number of resources you want returned, between 1 and 100. Defaults to 20.
 	Limit *Limit `form:"limit,omitempty" json:"limit,omitempty"`
 
-	// Offset the number of resources you want to skip before returning results. should be a non negative integer.
-	Offset *Offset `form:"offset,omitempty" json:"offset,omitempty"`
+	// Cursor opaque cursor taken from the next or prev link of a previous page. Only valid with the sort it was issued for.
+	Cursor *Cursor `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Sort the order to return offers in. Prefix with '-' for descending order. Offers that tie are ordered by offerId.
+	Sort *GetOffersParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
 
 	// OffererUserId query parameter to filter results by offererId
 	OffererUserId *SortByOfferer `form:"offererUserId,omitempty" json:"offererUserId,omitempty"`
 
-	// RecipientUserId query parameter to filter results by offererId
+	// RecipientUserId query parameter to filter results by recipientId
 	RecipientUserId *SortByRecipient `form:"recipientUserId,omitempty" json:"recipientUserId,omitempty"`
+
+	// InvolvingUserId query parameter to filter offers the user is either the offerer or the recipient of.
+	InvolvingUserId *InvolvingUserId `form:"involvingUserId,omitempty" json:"involvingUserId,omitempty"`
+
+	// Status query parameter to filter offers by status. Repeat it to match any of several statuses.
+	Status *OfferStatus `form:"status,omitempty" json:"status,omitempty"`
+
+	// GameId query parameter to filter offers that include the game, on either side.
+	GameId *OfferGameId `form:"gameId,omitempty" json:"gameId,omitempty"`
+
+	// CreatedAfter query parameter to filter out offers created before the time.
+	CreatedAfter *CreatedAfter `form:"createdAfter,omitempty" json:"createdAfter,omitempty"`
+
+	// CreatedBefore query parameter to filter out offers created at or after the time.
+	CreatedBefore *CreatedBefore `form:"createdBefore,omitempty" json:"createdBefore,omitempty"`
 }
 
+// GetOffersParamsSort defines parameters for GetOffers.
+type GetOffersParamsSort string
+
 // CreateOfferJSONBody defines parameters for CreateOffer.
 type CreateOfferJSONBody struct {
-	// OffererGameId the integer representing the game being traded by the offerer
-	OffererGameId int `json:"offererGameId"`
+	// ExpiresAt when the offer expires if it's still pending. Must be in the future. Defaults to the server's offer lifetime after the offer is made, which is a week unless configured otherwise.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// OffererGameIds the gameIds of the games being traded by the offerer
+	OffererGameIds []int `json:"offererGameIds"`
 
 	// OffererUserId the integer representing the trade creator's userId
 	OffererUserId int `json:"offererUserId"`
 
-	// RecipientGameId the integer representing the game being requested of the reipient
-	RecipientGameId int `json:"recipientGameId"`
+	// RecipientGameIds the gameIds of the games being requested of the recipient
+	RecipientGameIds []int `json:"recipientGameIds"`
 
 	// RecipientUserId the integer representing the trade receiver's userId
 	RecipientUserId int `json:"recipientUserId"`
 }
 
+// CounterOfferJSONBody defines parameters for CounterOffer.
+type CounterOfferJSONBody struct {
+	// ExpiresAt when the counter-offer expires if it's still pending. Must be in the future. Defaults to the server's offer lifetime after the counter-offer is made, which is a week unless configured otherwise.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// OffererGameIds the gameIds of the games the user countering the offer gives up
+	OffererGameIds []int `json:"offererGameIds"`
+
+	// RecipientGameIds the gameIds of the games requested of the user who made the original offer
+	RecipientGameIds []int `json:"recipientGameIds"`
+}
+
 // CreateUserJSONBody defines parameters for CreateUser.
 type CreateUserJSONBody struct {
 	Address  string `json:"address"`
@@ -273,6 +567,9 @@ type UpdateUserJSONBody struct {
 	Password *string `json:"password,omitempty"`
 }
 
+// LoginJSONRequestBody defines body for Login for application/json ContentType.
+type LoginJSONRequestBody LoginJSONBody
+
 // CreateGameJSONRequestBody defines body for CreateGame for application/json ContentType.
 type CreateGameJSONRequestBody CreateGameJSONBody
 
@@ -285,8 +582,14 @@ type CreateOfferJSONRequestBody CreateOfferJSONBody
 // UpdateOfferJSONRequestBody defines body for UpdateOffer for application/json ContentType.
 type UpdateOfferJSONRequestBody = OfferStatusEnum
 
+// CounterOfferJSONRequestBody defines body for CounterOffer for application/json ContentType.
+type CounterOfferJSONRequestBody CounterOfferJSONBody
+
 // CreateUserJSONRequestBody defines body for CreateUser for application/json ContentType.
 type CreateUserJSONRequestBody CreateUserJSONBody
 
 // UpdateUserJSONRequestBody defines body for UpdateUser for application/json ContentType.
 type UpdateUserJSONRequestBody UpdateUserJSONBody
+
+// UpdatePreferencesJSONRequestBody defines body for UpdatePreferences for application/json ContentType.
+type UpdatePreferencesJSONRequestBody = NotificationPreferences
@@ -1,28 +1,42 @@
 package api
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// ActorIdKey is the gin context key holding the userId of the authenticated caller.
+const ActorIdKey = "actorId"
+
+// Mutating methods take the userId of the authenticated caller (the actor) so the service can
+// enforce ownership rules.
 type Service interface {
+	Login(credentials *PostLogin) (*LoginResponse, error)
+
 	GetUser(id UserId) (*UserResponse, error)
 	CreateUser(user *PostUser) (*UserResponse, error)
-	UpdateUser(id UserId, user *PatchUser) error
-	DeleteUser(id UserId) error
+	UpdateUser(actorId UserId, id UserId, user *PatchUser) error
+	DeleteUser(actorId UserId, id UserId) error
+	GetPreferences(actorId UserId, id UserId) (*NotificationPreferences, error)
+	UpdatePreferences(actorId UserId, id UserId, preferences *PutPreferences) error
 
 	GetGame(id GameId) (*GameResponse, error)
 	GetGames(params *GetGamesParams) (*GameSearchResponse, error)
-	CreateGame(game *PostGame) (*GameResponse, error)
-	UpdateGame(id GameId, game *PatchGame) error
-	DeleteGame(id GameId) error
+	CreateGame(actorId UserId, game *PostGame) (*GameResponse, error)
+	UpdateGame(actorId UserId, id GameId, game *PatchGame) error
+	DeleteGame(actorId UserId, id GameId) error
 
 	GetOffer(id OfferId) (*OfferResponse, error)
 	GetOffers(params *GetOffersParams) (*OfferSearchResponse, error)
-	CreateOffer(offer *PostOffer) (*OfferResponse, error)
-	UpdateOffer(id OfferId, offer *PatchOffer) error
-	DeleteOffer(id OfferId) error
+	CreateOffer(actorId UserId, offer *PostOffer) (*OfferResponse, error)
+	UpdateOffer(actorId UserId, id OfferId, offer *PatchOffer) error
+	DeleteOffer(actorId UserId, id OfferId) error
+	CounterOffer(actorId UserId, id OfferId, counter *PostCounterOffer) (*OfferResponse, error)
+	GetOfferHistory(id OfferId) (*OfferHistoryResponse, error)
+	GetOfferEvents(id OfferId) (*OfferEventsResponse, error)
 }
 
 type GameTrader struct {
@@ -33,6 +47,24 @@ func Init(service Service) *GameTrader {
 	return &GameTrader{service}
 }
 
+//------------------- Auth -------------------//
+
+func (g *GameTrader) Login(c *gin.Context) {
+	var postLoginData PostLogin
+	err := c.BindJSON(&postLoginData)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	login, err := g.service.Login(&postLoginData)
+	if err != nil {
+		abortWithError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, login)
+}
+
 //------------------- User -------------------//
 
 func (g *GameTrader) CreateUser(c *gin.Context) {
@@ -45,8 +77,7 @@ func (g *GameTrader) CreateUser(c *gin.Context) {
 
 	user, err := g.service.CreateUser(&postUserData)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusBadRequest)
+		abortWithError(c, err, http.StatusBadRequest)
 		return
 	}
 	c.JSON(http.StatusCreated, user)
@@ -55,8 +86,7 @@ func (g *GameTrader) CreateUser(c *gin.Context) {
 func (g *GameTrader) GetUser(c *gin.Context, userId UserId) {
 	user, err := g.service.GetUser(userId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
 		return
 	}
 	c.JSON(http.StatusOK, user)
@@ -70,10 +100,9 @@ func (g *GameTrader) UpdateUser(c *gin.Context, userId UserId) {
 		return
 	}
 
-	err = g.service.UpdateUser(userId, &patchUserData)
+	err = g.service.UpdateUser(actorId(c), userId, &patchUserData)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusBadRequest)
+		abortWithError(c, err, http.StatusBadRequest)
 		return
 	}
 
@@ -81,10 +110,35 @@ func (g *GameTrader) UpdateUser(c *gin.Context, userId UserId) {
 }
 
 func (g *GameTrader) DeleteUser(c *gin.Context, userId UserId) {
-	err := g.service.DeleteUser(userId)
+	err := g.service.DeleteUser(actorId(c), userId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (g *GameTrader) GetPreferences(c *gin.Context, userId UserId) {
+	preferences, err := g.service.GetPreferences(actorId(c), userId)
+	if err != nil {
+		abortWithError(c, err, http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
+
+func (g *GameTrader) UpdatePreferences(c *gin.Context, userId UserId) {
+	var putPreferencesData PutPreferences
+	err := c.BindJSON(&putPreferencesData)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	err = g.service.UpdatePreferences(actorId(c), userId, &putPreferencesData)
+	if err != nil {
+		abortWithError(c, err, http.StatusBadRequest)
 		return
 	}
 
@@ -101,10 +155,9 @@ func (g *GameTrader) CreateGame(c *gin.Context) {
 		return
 	}
 
-	game, err := g.service.CreateGame(&postGameData)
+	game, err := g.service.CreateGame(actorId(c), &postGameData)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusInternalServerError)
+		abortWithError(c, err, http.StatusInternalServerError)
 		return
 	}
 	c.JSON(http.StatusCreated, game)
@@ -113,8 +166,7 @@ func (g *GameTrader) CreateGame(c *gin.Context) {
 func (g *GameTrader) GetGame(c *gin.Context, gameId GameId) {
 	game, err := g.service.GetGame(gameId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
 		return
 	}
 	c.JSON(http.StatusOK, game)
@@ -123,8 +175,7 @@ func (g *GameTrader) GetGame(c *gin.Context, gameId GameId) {
 func (g *GameTrader) GetGames(c *gin.Context, params GetGamesParams) {
 	games, err := g.service.GetGames(&params)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
 		return
 	}
 	c.JSON(http.StatusOK, games)
@@ -139,10 +190,9 @@ func (g *GameTrader) UpdateGame(c *gin.Context, gameId GameId) {
 		return
 	}
 
-	err = g.service.UpdateGame(gameId, &patchGameData)
+	err = g.service.UpdateGame(actorId(c), gameId, &patchGameData)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusInternalServerError)
+		abortWithError(c, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -150,10 +200,9 @@ func (g *GameTrader) UpdateGame(c *gin.Context, gameId GameId) {
 }
 
 func (g *GameTrader) DeleteGame(c *gin.Context, gameId GameId) {
-	err := g.service.DeleteGame(gameId)
+	err := g.service.DeleteGame(actorId(c), gameId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusInternalServerError)
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -169,11 +218,10 @@ func (g *GameTrader) CreateOffer(c *gin.Context) {
 		return
 	}
 
-	offer, err := g.service.CreateOffer(&postOfferData)
+	offer, err := g.service.CreateOffer(actorId(c), &postOfferData)
 	if err != nil {
-		// Degugging purposes
-		c.Error(err)
-		c.Status(http.StatusBadRequest)
+		abortWithError(c, err, http.StatusBadRequest)
+		return
 	}
 
 	c.JSON(http.StatusCreated, offer)
@@ -182,8 +230,7 @@ func (g *GameTrader) CreateOffer(c *gin.Context) {
 func (g *GameTrader) GetOffer(c *gin.Context, offerId OfferId) {
 	offer, err := g.service.GetOffer(offerId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
 		return
 	}
 	c.JSON(http.StatusOK, offer)
@@ -192,8 +239,7 @@ func (g *GameTrader) GetOffer(c *gin.Context, offerId OfferId) {
 func (g *GameTrader) GetOffers(c *gin.Context, params GetOffersParams) {
 	offers, err := g.service.GetOffers(&params)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusNotFound)
 		return
 	}
 
@@ -208,23 +254,83 @@ func (g *GameTrader) UpdateOffer(c *gin.Context, offerId OfferId) {
 		return
 	}
 
-	err = g.service.UpdateOffer(offerId, &patchOfferData)
+	err = g.service.UpdateOffer(actorId(c), offerId, &patchOfferData)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusInternalServerError)
+		abortWithError(c, err, http.StatusInternalServerError)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
 
+func (g *GameTrader) CounterOffer(c *gin.Context, offerId OfferId) {
+	var postCounterOfferData PostCounterOffer
+	err := c.BindJSON(&postCounterOfferData)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	offer, err := g.service.CounterOffer(actorId(c), offerId, &postCounterOfferData)
+	if err != nil {
+		abortWithError(c, err, http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusCreated, offer)
+}
+
+func (g *GameTrader) GetOfferHistory(c *gin.Context, offerId OfferId) {
+	history, err := g.service.GetOfferHistory(offerId)
+	if err != nil {
+		abortWithError(c, err, http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+func (g *GameTrader) GetOfferEvents(c *gin.Context, offerId OfferId) {
+	offerEvents, err := g.service.GetOfferEvents(offerId)
+	if err != nil {
+		abortWithError(c, err, http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, offerEvents)
+}
+
 func (g *GameTrader) DeleteOffer(c *gin.Context, offerId OfferId) {
-	err := g.service.DeleteOffer(offerId)
+	err := g.service.DeleteOffer(actorId(c), offerId)
 	if err != nil {
-		c.Error(err)
-		c.Status(http.StatusNotFound)
+		abortWithError(c, err, http.StatusInternalServerError)
 		return
 	}
 
 	c.Status(http.StatusNoContent)
 }
+
+//------------------- Helpers -------------------//
+
+// Returns the userId of the authenticated caller, or 0 if the request wasn't authenticated.
+func actorId(c *gin.Context) UserId {
+	return c.GetInt(ActorIdKey)
+}
+
+// Records the error and writes the status code for it. Errors the service layer classifies, and
+// rows that don't exist, get their own status code; anything else is written with the fallback status.
+func abortWithError(c *gin.Context, err error, fallback int) {
+	c.Error(err)
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		c.Status(http.StatusUnauthorized)
+	case errors.Is(err, ErrForbidden):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, ErrConflict):
+		c.Status(http.StatusConflict)
+	case errors.Is(err, ErrBadRequest):
+		c.Status(http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		c.Status(http.StatusNotFound)
+	default:
+		c.Status(fallback)
+	}
+}
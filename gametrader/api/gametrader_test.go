@@ -0,0 +1,92 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fails every update and delete with err. The other methods aren't used.
+type fakeService struct {
+	Service
+	err error
+}
+
+func (s *fakeService) UpdateOffer(actorId UserId, id OfferId, offer *PatchOffer) error {
+	return s.err
+}
+
+func (s *fakeService) DeleteGame(actorId UserId, id GameId) error {
+	return s.err
+}
+
+func (s *fakeService) DeleteOffer(actorId UserId, id OfferId) error {
+	return s.err
+}
+
+func TestUpdateOfferStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"updated", nil, http.StatusNoContent},
+		{"missing offer", sql.ErrNoRows, http.StatusNotFound},
+		{"wrapped missing offer", fmt.Errorf("locking offer: %w", sql.ErrNoRows), http.StatusNotFound},
+		{"not the recipient", ErrForbidden, http.StatusForbidden},
+		{"no longer pending", ErrConflict, http.StatusConflict},
+		{"unexpected error", fmt.Errorf("connection refused"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			RegisterHandlers(router, Init(&fakeService{err: test.err}))
+
+			request := httptest.NewRequest(http.MethodPatch, "/offers/42", strings.NewReader(`"accepted"`))
+			request.Header.Set("Content-Type", "application/json")
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != test.expected {
+				t.Errorf("expected status %v, got %v", test.expected, response.Code)
+			}
+		})
+	}
+}
+
+func TestDeleteStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"deleted", nil, http.StatusNoContent},
+		{"missing", sql.ErrNoRows, http.StatusNotFound},
+		{"not the owner", ErrForbidden, http.StatusForbidden},
+		{"unexpected error", fmt.Errorf("connection refused"), http.StatusInternalServerError},
+	}
+	for _, path := range []string{"/games/42", "/offers/42"} {
+		for _, test := range tests {
+			t.Run(path+" "+test.name, func(t *testing.T) {
+				router := gin.New()
+				RegisterHandlers(router, Init(&fakeService{err: test.err}))
+
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, httptest.NewRequest(http.MethodDelete, path, nil))
+
+				if response.Code != test.expected {
+					t.Errorf("expected status %v, got %v", test.expected, response.Code)
+				}
+			})
+		}
+	}
+}
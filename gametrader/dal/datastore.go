@@ -2,7 +2,9 @@ package dal
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,7 +13,40 @@ import (
 
 // Implements all methods in the Datastore interaface
 type SQLDatastore struct {
-	db *sql.DB
+	conn *sql.DB
+	// Either the connection pool or the transaction the datastore was handed to in WithTx
+	db querier
+}
+
+// Satisfied by both *sql.DB and *sql.Tx, so the same queries can run inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// The datastore operations available inside a transaction started by WithTx.
+type TxStore interface {
+	GetUser(id int) (*User, error)
+	UpdateUser(id int, user *User) error
+
+	GetGame(id int) (*Game, error)
+	GetGameForUpdate(id int) (*Game, error)
+	ChangeGameUserId(id int, userId int) error
+
+	GetOfferForUpdate(id int) (*Offer, error)
+	CreateOffer(offer *Offer) (*Offer, error)
+	UpdateOffer(id int, offer *Offer) error
+	ClaimExpiredOffers(now time.Time, limit int) ([]Offer, error)
+	GetPendingOffersWithGames(gameIds []int) ([]Offer, error)
+	ClaimPendingOffersWithGames(gameIds []int) ([]Offer, error)
+	CreateOfferEvent(event *OfferEvent) error
+
+	CreateOutboxMessage(message *OutboxMessage) error
+	ClaimOutboxMessages(limit int, lease time.Duration) ([]OutboxMessage, error)
+	MarkOutboxMessageSent(id int) error
+	MarkOutboxMessageFailed(id int, reason string, retryIn time.Duration) error
+	ReleaseOutboxMessage(id int) error
 }
 
 // Initializes the database connection to the MySQL database, using the username and password provided,
@@ -27,19 +62,22 @@ func Init(user string, pass string, net string, address string, port string, dbN
 		Net:    net,
 		Addr:   address + ":" + port,
 		DBName: dbName,
+		// Scan DATETIME columns into time.Time
+		ParseTime: true,
 	}
 	// Open the connection
 	fmt.Printf("Connecting to database with %s\n", cfg.FormatDSN())
 	var err error
-	d.db, err = sql.Open("mysql", cfg.FormatDSN())
+	d.conn, err = sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
+	d.db = d.conn
 
 	connected := false
 	for attempts := 0; attempts < 5; attempts++ {
 		// Test the connection
-		if err := d.db.Ping(); err != nil {
+		if err := d.conn.Ping(); err != nil {
 			fmt.Println("Failed to connect to the database. Retrying in 10 seconds...")
 			time.Sleep(10 * time.Second)
 		} else {
@@ -58,14 +96,40 @@ func Init(user string, pass string, net string, address string, port string, dbN
 }
 
 func (d *SQLDatastore) Close() error {
-	return d.db.Close()
+	return d.conn.Close()
+}
+
+// Runs fn inside a single transaction, committing if it returns nil and rolling back otherwise.
+func (d *SQLDatastore) WithTx(fn func(tx TxStore) error) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// Rolling back after a successful commit is a no-op
+	defer tx.Rollback()
+
+	err = fn(&SQLDatastore{conn: d.conn, db: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // ------------------- User -------------------//
 
 func (d *SQLDatastore) GetUser(id int) (*User, error) {
 	var user User
-	err := d.db.QueryRow("SELECT * FROM users WHERE `userId` = ?", id).Scan(&user.UserId, &user.Email, &user.Name, &user.Address)
+	err := d.db.QueryRow("SELECT `userId`, `email`, `name`, `address` FROM users WHERE `userId` = ?", id).Scan(&user.UserId, &user.Email, &user.Name, &user.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Retrieves the user with the given email, including the stored password hash, for credential checks.
+func (d *SQLDatastore) GetUserByEmail(email string) (*User, error) {
+	var user User
+	err := d.db.QueryRow("SELECT `userId`, `email`, `name`, `address`, `password` FROM users WHERE `email` = ?", email).Scan(&user.UserId, &user.Email, &user.Name, &user.Address, &user.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -125,48 +189,76 @@ func (d *SQLDatastore) DeleteUser(id int) error {
 	return err
 }
 
-// ------------------- Game -------------------//
+// ------------------- Notification Preferences -------------------//
 
-func (d *SQLDatastore) GetGame(id int) (*Game, error) {
-	var game Game
-	err := d.db.QueryRow("SELECT * FROM games WHERE `gameId` = ?", id).Scan(&game.GameId, &game.UserId, &game.Name, &game.Publisher, &game.Year, &game.System, &game.Condition, &game.Owners)
+// Returns sql.ErrNoRows if the user has never saved their preferences.
+func (d *SQLDatastore) GetNotificationPreferences(userId int) (*NotificationPreferences, error) {
+	var preferences NotificationPreferences
+	var channels, mutedEvents string
+	err := d.db.QueryRow("SELECT `userId`, `channels`, `mutedEvents`, `delivery` FROM notification_preferences WHERE `userId` = ?", userId).Scan(&preferences.UserId, &channels, &mutedEvents, &preferences.Delivery)
 	if err != nil {
 		return nil, err
 	}
-	return &game, nil
+	preferences.Channels = splitSet(channels)
+	preferences.MutedEvents = splitSet(mutedEvents)
+	return &preferences, nil
 }
 
-func (d *SQLDatastore) GetGames(userId *int, offset *int, limit *int) ([]Game, error) {
-	var games []Game
-	var rows *sql.Rows
-	var err error
-	query := "SELECT * FROM games"
-	args := []interface{}{}
+// Creates or replaces the user's preferences.
+func (d *SQLDatastore) PutNotificationPreferences(userId int, preferences *NotificationPreferences) error {
+	_, err := d.db.Exec("INSERT INTO notification_preferences (`userId`, `channels`, `mutedEvents`, `delivery`) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `channels` = VALUES(`channels`), `mutedEvents` = VALUES(`mutedEvents`), `delivery` = VALUES(`delivery`)",
+		userId, strings.Join(preferences.Channels, ","), strings.Join(preferences.MutedEvents, ","), preferences.Delivery)
+	return err
+}
 
-	if userId != nil {
-		query += " WHERE `userId` = ?"
-		args = append(args, *userId)
-	}
-	if limit != nil {
-		query += " LIMIT ?"
-		args = append(args, *limit)
+// Splits the value of a MySQL SET column into its members.
+func splitSet(value string) []string {
+	if value == "" {
+		return []string{}
 	}
-	if offset != nil {
-		query += " OFFSET ?"
-		args = append(args, *offset)
+	return strings.Split(value, ",")
+}
+
+// ------------------- Game -------------------//
+
+// The columns of the games table, in the order scanGame reads them
+const gameColumns = "`gameId`, `userId`, `name`, `publisher`, `year`, `system`, `condition`, `owners`, `createdAt`"
+
+func (d *SQLDatastore) GetGame(id int) (*Game, error) {
+	return scanGame(d.db.QueryRow("SELECT "+gameColumns+" FROM games WHERE `gameId` = ?", id))
+}
+
+// Retrieves the game and locks its row until the surrounding transaction ends.
+func (d *SQLDatastore) GetGameForUpdate(id int) (*Game, error) {
+	return scanGame(d.db.QueryRow("SELECT "+gameColumns+" FROM games WHERE `gameId` = ? FOR UPDATE", id))
+}
+
+func (d *SQLDatastore) GetGames(filter *GameFilter, page *Page) ([]Game, error) {
+	var games []Game
+	where := gameConditions(filter)
+
+	order, err := keyset(where, page, "`gameId`")
+	if err != nil {
+		return nil, err
 	}
-	rows, err = d.db.Query(query, args...)
+	rows, err := d.db.Query("SELECT "+gameColumns+" FROM games"+where.String()+order, append(where.args, page.Limit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var game Game
-		err := rows.Scan(&game.GameId, &game.UserId, &game.Name, &game.Publisher, &game.Year, &game.System, &game.Condition, &game.Owners)
+		game, err := scanGame(rows)
 		if err != nil {
 			return nil, err
 		}
-		games = append(games, game)
+		games = append(games, *game)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if page.Before != nil {
+		slices.Reverse(games)
 	}
 	return games, nil
 }
@@ -252,56 +344,173 @@ func (d *SQLDatastore) ChangeGameUserId(id int, userId int) error {
 }
 
 // ------------------- Offers -------------------//
+
+// The columns of the offers table, in the order scanOffer reads them
+const offerColumns = "`offerId`, `offererUserId`, `recipientUserId`, `status`, `parentOfferId`, `createdAt`, `expiresAt`"
+
 func (d *SQLDatastore) GetOffer(id int) (*Offer, error) {
-	var offer Offer
-	err := d.db.QueryRow("SELECT * FROM offers WHERE `offerId` = ?", id).Scan(&offer.OfferId, &offer.OffererUserId, &offer.RecipientUserId, &offer.OffererGameId, &offer.RecipientGameId, &offer.Status)
+	offer, err := scanOffer(d.db.QueryRow("SELECT "+offerColumns+" FROM offers WHERE `offerId` = ?", id))
 	if err != nil {
 		return nil, err
 	}
-	return &offer, nil
+	return offer, d.getOfferItems([]*Offer{offer})
 }
 
-func (d *SQLDatastore) GetOffers(offererUserId *int, recipientUserId *int, limit *int, offset *int) ([]Offer, error) {
+// Retrieves the offer and locks its row until the surrounding transaction ends. Its items aren't
+// locked, since they never change once the offer is created.
+func (d *SQLDatastore) GetOfferForUpdate(id int) (*Offer, error) {
+	offer, err := scanOffer(d.db.QueryRow("SELECT "+offerColumns+" FROM offers WHERE `offerId` = ? FOR UPDATE", id))
+	if err != nil {
+		return nil, err
+	}
+	return offer, d.getOfferItems([]*Offer{offer})
+}
+
+func (d *SQLDatastore) GetOffers(filter *OfferFilter, page *Page) ([]Offer, error) {
 	var offers []Offer
-	var rows *sql.Rows
-	var err error
-	query := "SELECT * FROM offers"
-	args := []interface{}{}
+	where := &conditions{}
 
-	if offererUserId != nil {
-		query += " WHERE `offererUserId` = ?"
-		args = append(args, *offererUserId)
-	}
-	if recipientUserId != nil {
-		query += " WHERE `recipientUserId` = ?"
-		args = append(args, *recipientUserId)
-	}
-	if limit != nil {
-		query += " LIMIT ?"
-		args = append(args, *limit)
+	if filter != nil {
+		if filter.OffererUserId != nil {
+			where.add("`offererUserId` = ?", *filter.OffererUserId)
+		}
+		if filter.RecipientUserId != nil {
+			where.add("`recipientUserId` = ?", *filter.RecipientUserId)
+		}
+		if filter.InvolvingUserId != nil {
+			where.add("(`offererUserId` = ? OR `recipientUserId` = ?)", *filter.InvolvingUserId, *filter.InvolvingUserId)
+		}
+		if len(filter.Statuses) > 0 {
+			in(where, "`status`", filter.Statuses)
+		}
+		if filter.GameId != nil {
+			where.add("EXISTS (SELECT 1 FROM offer_items WHERE offer_items.`offerId` = offers.`offerId` AND offer_items.`gameId` = ?)", *filter.GameId)
+		}
+		if filter.CreatedAfter != nil {
+			where.add("`createdAt` >= ?", *filter.CreatedAfter)
+		}
+		if filter.CreatedBefore != nil {
+			where.add("`createdAt` < ?", *filter.CreatedBefore)
+		}
 	}
-	if offset != nil {
-		query += " OFFSET ?"
-		args = append(args, *offset)
+
+	order, err := keyset(where, page, "`offerId`")
+	if err != nil {
+		return nil, err
 	}
-	rows, err = d.db.Query(query, args...)
+	rows, err := d.db.Query("SELECT "+offerColumns+" FROM offers"+where.String()+order, append(where.args, page.Limit)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var offer Offer
-		err := rows.Scan(&offer.OfferId, &offer.OffererUserId, &offer.RecipientUserId, &offer.OffererGameId, &offer.RecipientGameId, &offer.Status)
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, *offer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if page.Before != nil {
+		slices.Reverse(offers)
+	}
+
+	pointers := make([]*Offer, len(offers))
+	for i := range offers {
+		pointers[i] = &offers[i]
+	}
+	return offers, d.getOfferItems(pointers)
+}
+
+// Retrieves the chain of counter-offers the offer is part of, oldest first: the offers it counters,
+// the offer itself and the offers that counter it. Each offer is countered at most once, so the
+// chain never branches.
+func (d *SQLDatastore) GetOfferHistory(id int) ([]Offer, error) {
+	offer, err := scanOffer(d.db.QueryRow("SELECT "+offerColumns+" FROM offers WHERE `offerId` = ?", id))
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back to the offer that started the negotiation
+	history := []*Offer{offer}
+	for offer.ParentOfferId != nil {
+		offer, err = scanOffer(d.db.QueryRow("SELECT "+offerColumns+" FROM offers WHERE `offerId` = ?", *offer.ParentOfferId))
 		if err != nil {
 			return nil, err
 		}
-		offers = append(offers, offer)
+		history = append(history, offer)
+	}
+	slices.Reverse(history)
+
+	// Then forward to the latest counter-offer
+	offer = history[len(history)-1]
+	for {
+		offer, err = scanOffer(d.db.QueryRow("SELECT "+offerColumns+" FROM offers WHERE `parentOfferId` = ? ORDER BY `offerId` LIMIT 1", *offer.OfferId))
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, offer)
+	}
+
+	err = d.getOfferItems(history)
+	if err != nil {
+		return nil, err
+	}
+	offers := []Offer{}
+	for _, offer := range history {
+		offers = append(offers, *offer)
 	}
 	return offers, nil
 }
 
+// Fills in the games on each side of the offers from offer_items.
+func (d *SQLDatastore) getOfferItems(offers []*Offer) error {
+	if len(offers) == 0 {
+		return nil
+	}
+
+	byId := map[int]*Offer{}
+	where := &conditions{}
+	ids := []int{}
+	for _, offer := range offers {
+		offer.OffererGameIds = []int{}
+		offer.RecipientGameIds = []int{}
+		byId[*offer.OfferId] = offer
+		ids = append(ids, *offer.OfferId)
+	}
+	in(where, "`offerId`", ids)
+
+	rows, err := d.db.Query("SELECT `offerId`, `gameId`, `side` FROM offer_items"+where.String()+" ORDER BY `offerId`, `gameId`", where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var offerId, gameId int
+		var side OfferSide
+		err := rows.Scan(&offerId, &gameId, &side)
+		if err != nil {
+			return err
+		}
+		offer := byId[offerId]
+		if side == OffererSide {
+			offer.OffererGameIds = append(offer.OffererGameIds, gameId)
+		} else {
+			offer.RecipientGameIds = append(offer.RecipientGameIds, gameId)
+		}
+	}
+	return rows.Err()
+}
+
+// Creates the offer and its items. Call it inside WithTx so a failure can't leave an offer without
+// its items.
 func (d *SQLDatastore) CreateOffer(offer *Offer) (*Offer, error) {
-	result, err := d.db.Exec("INSERT INTO offers (`offererUserId`, `recipientUserId`, `offererGameId`, `recipientGameId`, `status`) VALUES (?, ?, ?, ?, ?)", offer.OffererUserId, offer.RecipientUserId, offer.OffererGameId, offer.RecipientGameId, offer.Status)
+	result, err := d.db.Exec("INSERT INTO offers (`offererUserId`, `recipientUserId`, `status`, `parentOfferId`, `expiresAt`) VALUES (?, ?, ?, ?, ?)", offer.OffererUserId, offer.RecipientUserId, offer.Status, offer.ParentOfferId, offer.ExpiresAt)
 	if err != nil {
 		return nil, err
 	}
@@ -314,6 +523,23 @@ func (d *SQLDatastore) CreateOffer(offer *Offer) (*Offer, error) {
 	intId := int(id)
 	offer.OfferId = &intId
 
+	values := []string{}
+	args := []interface{}{}
+	for _, gameId := range offer.OffererGameIds {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, intId, gameId, OffererSide)
+	}
+	for _, gameId := range offer.RecipientGameIds {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, intId, gameId, RecipientSide)
+	}
+	if len(values) > 0 {
+		_, err = d.db.Exec("INSERT INTO offer_items (`offerId`, `gameId`, `side`) VALUES "+strings.Join(values, ", "), args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return offer, nil
 }
 
@@ -336,7 +562,180 @@ func (d *SQLDatastore) UpdateOffer(id int, offer *Offer) error {
 	return err
 }
 
-func (d *SQLDatastore) DeleteOffer(id int) error {
-	_, err := d.db.Exec("DELETE FROM offers WHERE `offerId` = ?", id)
+// Retrieves pending offers that expired at or before now, soonest expiry first, and locks them until
+// the surrounding transaction ends. Rows already locked by another sweeper or by a request updating
+// the offer are skipped, so several instances can sweep the same table without expiring an offer twice.
+func (d *SQLDatastore) ClaimExpiredOffers(now time.Time, limit int) ([]Offer, error) {
+	return d.queryOffers("SELECT "+offerColumns+" FROM offers WHERE `status` = ? AND `expiresAt` <= ? ORDER BY `expiresAt`, `offerId` LIMIT ? FOR UPDATE SKIP LOCKED", Pending, now, limit)
+}
+
+// Retrieves the pending offers that include any of the games, on either side.
+func (d *SQLDatastore) GetPendingOffersWithGames(gameIds []int) ([]Offer, error) {
+	if len(gameIds) == 0 {
+		return nil, nil
+	}
+	where := pendingWithGames(gameIds)
+	return d.queryOffers("SELECT "+offerColumns+" FROM offers"+where.String()+" ORDER BY `offerId`", where.args...)
+}
+
+// Retrieves the pending offers that include any of the games and locks them until the surrounding
+// transaction ends. Offers locked by another transaction are skipped rather than waited for, since
+// that transaction may be waiting for games this one has locked.
+func (d *SQLDatastore) ClaimPendingOffersWithGames(gameIds []int) ([]Offer, error) {
+	if len(gameIds) == 0 {
+		return nil, nil
+	}
+	where := pendingWithGames(gameIds)
+	return d.queryOffers("SELECT "+offerColumns+" FROM offers"+where.String()+" ORDER BY `offerId` FOR UPDATE SKIP LOCKED", where.args...)
+}
+
+// Selects the pending offers with an item that is one of the games.
+func pendingWithGames(gameIds []int) *conditions {
+	items := &conditions{}
+	items.add("offer_items.`offerId` = offers.`offerId`")
+	in(items, "offer_items.`gameId`", gameIds)
+
+	where := &conditions{}
+	where.add("`status` = ?", Pending)
+	where.add("EXISTS (SELECT 1 FROM offer_items"+items.String()+")", items.args...)
+	return where
+}
+
+// Runs a query selecting offerColumns and loads the items of the offers it returns.
+func (d *SQLDatastore) queryOffers(query string, args ...interface{}) ([]Offer, error) {
+	var offers []Offer
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, *offer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pointers := make([]*Offer, len(offers))
+	for i := range offers {
+		pointers[i] = &offers[i]
+	}
+	return offers, d.getOfferItems(pointers)
+}
+
+// ------------------- Offer events -------------------//
+
+func (d *SQLDatastore) CreateOfferEvent(event *OfferEvent) error {
+	result, err := d.db.Exec("INSERT INTO offer_events (`offerId`, `fromStatus`, `toStatus`, `actorUserId`, `reason`) VALUES (?, ?, ?, ?, ?)", event.OfferId, event.FromStatus, event.ToStatus, event.ActorUserId, event.Reason)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	intId := int(id)
+	event.OfferEventId = &intId
+
+	return nil
+}
+
+// Retrieves every status change of the offer, oldest first.
+func (d *SQLDatastore) GetOfferEvents(offerId int) ([]OfferEvent, error) {
+	events := []OfferEvent{}
+	rows, err := d.db.Query("SELECT `offerEventId`, `offerId`, `fromStatus`, `toStatus`, `actorUserId`, `reason`, `createdAt` FROM offer_events WHERE `offerId` = ? ORDER BY `offerEventId`", offerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event OfferEvent
+		err := rows.Scan(&event.OfferEventId, &event.OfferId, &event.FromStatus, &event.ToStatus, &event.ActorUserId, &event.Reason, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ------------------- Outbox -------------------//
+
+func (d *SQLDatastore) CreateOutboxMessage(message *OutboxMessage) error {
+	result, err := d.db.Exec("INSERT INTO outbox (`topic`, `key`, `value`) VALUES (?, ?, ?)", message.Topic, message.Key, message.Value)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	intId := int(id)
+	message.OutboxId = &intId
+
+	return nil
+}
+
+// Retrieves the oldest unsent messages that are due to be published and leases them, so they aren't
+// due again until the lease has passed. Rows locked by another relay that is claiming at the same
+// time are skipped, so several instances can relay the same outbox without publishing a message
+// twice, and the messages can be published after the transaction commits. Messages are held back
+// while an earlier message with the same topic and key is unsent, so the batch has at most one
+// message per key and messages for the same key are published in the order they were written.
+func (d *SQLDatastore) ClaimOutboxMessages(limit int, lease time.Duration) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	rows, err := d.db.Query("SELECT `outboxId`, `topic`, `key`, `value`, `attempts` FROM outbox o WHERE `sentAt` IS NULL AND `nextAttemptAt` <= NOW() AND NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.`topic` = o.`topic` AND earlier.`key` = o.`key` AND earlier.`sentAt` IS NULL AND earlier.`outboxId` < o.`outboxId`) ORDER BY `outboxId` LIMIT ? FOR UPDATE SKIP LOCKED", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message OutboxMessage
+		err := rows.Scan(&message.OutboxId, &message.Topic, &message.Key, &message.Value, &message.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	args := []interface{}{int(lease.Seconds())}
+	for _, message := range messages {
+		args = append(args, *message.OutboxId)
+	}
+	_, err = d.db.Exec("UPDATE outbox SET `nextAttemptAt` = NOW() + INTERVAL ? SECOND WHERE `outboxId` IN (?"+strings.Repeat(", ?", len(messages)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (d *SQLDatastore) MarkOutboxMessageSent(id int) error {
+	_, err := d.db.Exec("UPDATE outbox SET `sentAt` = NOW() WHERE `outboxId` = ?", id)
+	return err
+}
+
+// Records a failed publish and holds the message back until retryIn has passed.
+func (d *SQLDatastore) MarkOutboxMessageFailed(id int, reason string, retryIn time.Duration) error {
+	_, err := d.db.Exec("UPDATE outbox SET `attempts` = `attempts` + 1, `lastError` = ?, `nextAttemptAt` = NOW() + INTERVAL ? SECOND WHERE `outboxId` = ?", reason, int(retryIn.Seconds()), id)
+	return err
+}
+
+// Ends the lease on a message that was claimed but not published, so it's due again straight away.
+func (d *SQLDatastore) ReleaseOutboxMessage(id int) error {
+	_, err := d.db.Exec("UPDATE outbox SET `nextAttemptAt` = NOW() WHERE `outboxId` = ? AND `sentAt` IS NULL", id)
 	return err
 }
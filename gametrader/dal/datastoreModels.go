@@ -1,5 +1,7 @@
 package dal
 
+import "time"
+
 type GameCondition string
 
 const (
@@ -16,8 +18,13 @@ const (
 	Accepted  StatusCondition = "accepted"
 	Rejected  StatusCondition = "rejected"
 	Cancelled StatusCondition = "cancelled"
+	Countered StatusCondition = "countered"
+	Expired   StatusCondition = "expired"
 )
 
+// Every offer status. Add new statuses here too so the transition tests cover them.
+var StatusConditions = []StatusCondition{Pending, Accepted, Rejected, Cancelled, Countered, Expired}
+
 type User struct {
 	UserId   *int    `json:"userId"`
 	Email    *string `json:"email"`
@@ -35,14 +42,119 @@ type Game struct {
 	System    *string        `json:"system"`
 	Condition *GameCondition `json:"condition"`
 	Owners    *int           `json:"owners,omitempty"`
+	CreatedAt *time.Time     `json:"createdAt"`
+}
+
+// Narrows GetGames down to the games that match every field that is set
+type GameFilter struct {
+	UserId        *int
+	ExcludeUserId *int
+	// Matches names containing the value, ignoring case
+	Name *string
+	// Full-text search of names and publishers
+	Query *string
+	// Matches any of the systems
+	Systems []string
+	// Matches any of the conditions
+	Conditions []GameCondition
+	Publisher  *string
+	MinYear    *int
+	MaxYear    *int
 }
 
 // some code
 type Offer struct {
-	OfferId         *int            `json:"offerId"`
-	OffererUserId   *int            `json:"offererUserId"`
-	OffererGameId   *int            `json:"offererGameId"`
-	RecipientUserId *int            `json:"recipientUserId"`
-	RecipientGameId *int            `json:"recipientGameId"`
-	Status          StatusCondition `json:"status"`
+	OfferId         *int `json:"offerId"`
+	OffererUserId   *int `json:"offererUserId"`
+	RecipientUserId *int `json:"recipientUserId"`
+	// The games each user gives up in the trade, stored in offer_items
+	OffererGameIds   []int           `json:"offererGameIds"`
+	RecipientGameIds []int           `json:"recipientGameIds"`
+	Status           StatusCondition `json:"status"`
+	// The offer this one counters, if it's a counter-offer
+	ParentOfferId *int       `json:"parentOfferId"`
+	CreatedAt     *time.Time `json:"createdAt"`
+	// When the offer expires if it's still pending
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// A change to an offer's status, kept in offer_events
+type OfferEvent struct {
+	OfferEventId *int `json:"offerEventId"`
+	OfferId      int  `json:"offerId"`
+	// Nil for the event that created the offer
+	FromStatus *StatusCondition `json:"fromStatus"`
+	ToStatus   StatusCondition  `json:"toStatus"`
+	// The user whose request changed the offer. Nil for changes nobody asked for, like expiry.
+	ActorUserId *int       `json:"actorUserId"`
+	Reason      *string    `json:"reason"`
+	CreatedAt   *time.Time `json:"createdAt"`
+}
+
+// Which side of an offer an offer_items row is on
+type OfferSide string
+
+const (
+	OffererSide   OfferSide = "offerer"
+	RecipientSide OfferSide = "recipient"
+)
+
+// Narrows GetOffers down to the offers that match every field that is set
+type OfferFilter struct {
+	OffererUserId   *int
+	RecipientUserId *int
+	// Matches offers the user is either the offerer or the recipient of
+	InvolvingUserId *int
+	// Matches any of the statuses
+	Statuses []StatusCondition
+	// Matches offers including the game on either side
+	GameId *int
+	// Matches offers created at or after the time
+	CreatedAfter *time.Time
+	// Matches offers created before the time
+	CreatedBefore *time.Time
+}
+
+// A user's notification preferences. Channels and MutedEvents are stored as MySQL SETs.
+type NotificationPreferences struct {
+	UserId      *int     `json:"userId"`
+	Channels    []string `json:"channels"`
+	MutedEvents []string `json:"mutedEvents"`
+	Delivery    string   `json:"delivery"`
+}
+
+// A message waiting in the outbox to be published to Kafka
+type OutboxMessage struct {
+	OutboxId *int   `json:"outboxId"`
+	Topic    string `json:"topic"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Attempts int    `json:"attempts"`
+}
+
+// A column that search results can be sorted by. Rows that tie are ordered by their id.
+type SortKey string
+
+const (
+	SortByName      SortKey = "name"
+	SortByYear      SortKey = "year"
+	SortByCondition SortKey = "condition"
+	SortByCreatedAt SortKey = "createdAt"
+)
+
+// Where a row falls in a sort order: its value of the sort key and its id. Condition values are the
+// condition's position in the enum, starting at 1 for mint.
+type Position struct {
+	Value interface{}
+	Id    int
+}
+
+// One page of search results, in keyset order. Set After or Before to the position of the last or
+// first row of the neighbouring page to continue from it.
+type Page struct {
+	Sort       SortKey
+	Descending bool
+	After      *Position
+	Before     *Position
+	Limit      int
 }
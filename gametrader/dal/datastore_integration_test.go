@@ -0,0 +1,516 @@
+//go:build integration
+
+// Integration tests against a real MySQL server. Run them with
+//
+//	GAMETRADER_TEST_DSN='root:password@tcp(localhost:3306)/gametrader_test' go test -tags integration ./dal
+//
+// The tests drop and recreate every table in the database, so never point the DSN at one you care about.
+package dal
+
+import (
+	"database/sql"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Opens the test database and recreates its tables from create-tables.sql. Skips the test if no DSN
+// is configured.
+func openTestDatastore(t *testing.T) *SQLDatastore {
+	t.Helper()
+	dsn := os.Getenv("GAMETRADER_TEST_DSN")
+	if dsn == "" {
+		t.Skip("GAMETRADER_TEST_DSN is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ParseTime = true
+	conn, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	schema, err := os.ReadFile("../../database/create-tables.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range strings.Split(string(schema), ";") {
+		statement = strings.TrimSpace(statement)
+		// The tests use whichever database the DSN names
+		if statement == "" || strings.HasPrefix(statement, "USE ") {
+			continue
+		}
+		_, err := conn.Exec(statement)
+		if err != nil {
+			t.Fatalf("creating tables: %v\n%v", err, statement)
+		}
+	}
+
+	return &SQLDatastore{conn: conn, db: conn}
+}
+
+func createTestUser(t *testing.T, d *SQLDatastore, name string) int {
+	t.Helper()
+	email := strings.ToLower(name) + "@example.com"
+	user, err := d.CreateUser(&User{Email: &email, Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *user.UserId
+}
+
+func createTestGame(t *testing.T, d *SQLDatastore, userId int, name string, year int, condition GameCondition) int {
+	t.Helper()
+	publisher, system := "Nintendo", "NES"
+	game, err := d.CreateGame(&Game{UserId: &userId, Name: &name, Publisher: &publisher, Year: &year, System: &system, Condition: &condition})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *game.GameId
+}
+
+// Offers expire a week after they're created
+func createTestOffer(t *testing.T, d *SQLDatastore, offerer, offererGame, recipient, recipientGame int, status StatusCondition, createdAt time.Time) int {
+	t.Helper()
+	expiresAt := createdAt.Add(7 * 24 * time.Hour)
+	offer, err := d.CreateOffer(&Offer{OffererUserId: &offerer, RecipientUserId: &recipient, OffererGameIds: []int{offererGame}, RecipientGameIds: []int{recipientGame}, Status: status, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.conn.Exec("UPDATE offers SET `createdAt` = ? WHERE `offerId` = ?", createdAt, *offer.OfferId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *offer.OfferId
+}
+
+func offerIds(offers []Offer) []int {
+	ids := []int{}
+	for _, offer := range offers {
+		ids = append(ids, *offer.OfferId)
+	}
+	return ids
+}
+
+func TestGetOffersFilters(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	carol := createTestUser(t, d, "Carol")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+	metroid := createTestGame(t, d, carol, "Metroid", 1986, Fair)
+
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	aliceToBob := createTestOffer(t, d, alice, halo, bob, zelda, Pending, march)
+	bobToAlice := createTestOffer(t, d, bob, zelda, alice, halo, Rejected, march.Add(time.Hour))
+	aliceToCarol := createTestOffer(t, d, alice, halo, carol, metroid, Accepted, april)
+	carolToBob := createTestOffer(t, d, carol, metroid, bob, zelda, Pending, april.Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		filter   *OfferFilter
+		expected []int
+	}{
+		{"no filter", nil, []int{aliceToBob, bobToAlice, aliceToCarol, carolToBob}},
+		{"offerer", &OfferFilter{OffererUserId: &alice}, []int{aliceToBob, aliceToCarol}},
+		{"recipient", &OfferFilter{RecipientUserId: &bob}, []int{aliceToBob, carolToBob}},
+		{"offerer and recipient", &OfferFilter{OffererUserId: &alice, RecipientUserId: &bob}, []int{aliceToBob}},
+		{"involving", &OfferFilter{InvolvingUserId: &carol}, []int{aliceToCarol, carolToBob}},
+		{"involving and offerer", &OfferFilter{InvolvingUserId: &bob, OffererUserId: &carol}, []int{carolToBob}},
+		{"one status", &OfferFilter{Statuses: []StatusCondition{Pending}}, []int{aliceToBob, carolToBob}},
+		{"several statuses", &OfferFilter{Statuses: []StatusCondition{Rejected, Accepted}}, []int{bobToAlice, aliceToCarol}},
+		{"game on either side", &OfferFilter{GameId: &metroid}, []int{aliceToCarol, carolToBob}},
+		{"created after", &OfferFilter{CreatedAfter: &april}, []int{aliceToCarol, carolToBob}},
+		{"created before", &OfferFilter{CreatedBefore: &april}, []int{aliceToBob, bobToAlice}},
+		{"everything", &OfferFilter{InvolvingUserId: &alice, Statuses: []StatusCondition{Pending, Rejected}, GameId: &zelda, CreatedAfter: &march, CreatedBefore: &april}, []int{aliceToBob, bobToAlice}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offers, err := d.GetOffers(tt.filter, &Page{Sort: SortByCreatedAt, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := offerIds(offers); !slices.Equal(ids, tt.expected) {
+				t.Errorf("expected offers %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestGetOffersPages(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+
+	// Two offers share a createdAt, so they're ordered by offerId
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	ids := []int{
+		createTestOffer(t, d, alice, halo, bob, zelda, Pending, start),
+		createTestOffer(t, d, alice, halo, bob, zelda, Pending, start.Add(time.Hour)),
+		createTestOffer(t, d, alice, halo, bob, zelda, Pending, start.Add(time.Hour)),
+		createTestOffer(t, d, alice, halo, bob, zelda, Pending, start.Add(2*time.Hour)),
+	}
+
+	first, err := d.GetOffers(nil, &Page{Sort: SortByCreatedAt, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offerIds(first); !slices.Equal(got, ids[:2]) {
+		t.Fatalf("expected first page %v, got %v", ids[:2], got)
+	}
+
+	last := first[len(first)-1].Position(SortByCreatedAt)
+	second, err := d.GetOffers(nil, &Page{Sort: SortByCreatedAt, Limit: 2, After: &last})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offerIds(second); !slices.Equal(got, ids[2:]) {
+		t.Fatalf("expected second page %v, got %v", ids[2:], got)
+	}
+
+	// Paging back from the second page returns the first in the same order
+	firstOfSecond := second[0].Position(SortByCreatedAt)
+	back, err := d.GetOffers(nil, &Page{Sort: SortByCreatedAt, Limit: 2, Before: &firstOfSecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offerIds(back); !slices.Equal(got, ids[:2]) {
+		t.Fatalf("expected to page back to %v, got %v", ids[:2], got)
+	}
+
+	descending, err := d.GetOffers(nil, &Page{Sort: SortByCreatedAt, Descending: true, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := offerIds(descending); !slices.Equal(got, []int{ids[3], ids[2], ids[1]}) {
+		t.Fatalf("expected descending page %v, got %v", []int{ids[3], ids[2], ids[1]}, got)
+	}
+}
+
+func TestOfferItems(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	fable := createTestGame(t, d, alice, "Fable", 2004, Fair)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+
+	expiresAt := time.Now().Add(time.Hour)
+	created, err := d.CreateOffer(&Offer{OffererUserId: &alice, RecipientUserId: &bob, OffererGameIds: []int{fable, halo}, RecipientGameIds: []int{zelda}, Status: Pending, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := d.GetOffer(*created.OfferId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(offer.OffererGameIds, []int{halo, fable}) || !slices.Equal(offer.RecipientGameIds, []int{zelda}) {
+		t.Errorf("expected items %v for %v, got %v for %v", []int{halo, fable}, []int{zelda}, offer.OffererGameIds, offer.RecipientGameIds)
+	}
+
+	offers, err := d.GetOffers(&OfferFilter{GameId: &fable}, &Page{Sort: SortByCreatedAt, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers) != 1 || !slices.Equal(offers[0].OffererGameIds, []int{halo, fable}) {
+		t.Errorf("expected the bundle when filtering by its second game, got %+v", offers)
+	}
+}
+
+func TestGetOfferHistory(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+
+	// Alice offers, Bob counters, Alice counters back
+	first := createTestOffer(t, d, alice, halo, bob, zelda, Countered, time.Now())
+	expiresAt := time.Now().Add(time.Hour)
+	second, err := d.CreateOffer(&Offer{OffererUserId: &bob, RecipientUserId: &alice, OffererGameIds: []int{zelda}, RecipientGameIds: []int{halo}, Status: Countered, ParentOfferId: &first, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := d.CreateOffer(&Offer{OffererUserId: &alice, RecipientUserId: &bob, OffererGameIds: []int{halo}, RecipientGameIds: []int{zelda}, Status: Pending, ParentOfferId: second.OfferId, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unrelated := createTestOffer(t, d, alice, halo, bob, zelda, Pending, time.Now())
+
+	expected := []int{first, *second.OfferId, *third.OfferId}
+	for _, id := range expected {
+		history, err := d.GetOfferHistory(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := offerIds(history); !slices.Equal(ids, expected) {
+			t.Errorf("expected the history of offer %v to be %v, got %v", id, expected, ids)
+		}
+	}
+
+	history, err := d.GetOfferHistory(unrelated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := offerIds(history); !slices.Equal(ids, []int{unrelated}) {
+		t.Errorf("expected an offer without counter-offers to be its own history, got %v", ids)
+	}
+}
+
+func TestClaimExpiredOffers(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+
+	// Both pending offers have expired, but only one of them is still pending
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := march.Add(30 * 24 * time.Hour)
+	expired := createTestOffer(t, d, alice, halo, bob, zelda, Pending, march)
+	createTestOffer(t, d, alice, halo, bob, zelda, Accepted, march)
+	createTestOffer(t, d, alice, halo, bob, zelda, Pending, now)
+
+	// A second sweeper skips the offers the first has claimed
+	first, err := d.conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Rollback()
+	claimed, err := (&SQLDatastore{conn: d.conn, db: first}).ClaimExpiredOffers(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := offerIds(claimed); !slices.Equal(ids, []int{expired}) {
+		t.Fatalf("expected to claim %v, got %v", []int{expired}, ids)
+	}
+	if !slices.Equal(claimed[0].OffererGameIds, []int{halo}) {
+		t.Errorf("expected the claimed offer's items to be loaded, got %v", claimed[0].OffererGameIds)
+	}
+
+	second, err := d.conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Rollback()
+	claimed, err = (&SQLDatastore{conn: d.conn, db: second}).ClaimExpiredOffers(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("expected the second sweeper to skip the locked offer, got %v", offerIds(claimed))
+	}
+}
+
+func TestPendingOffersWithGames(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	fable := createTestGame(t, d, alice, "Fable", 2004, Fair)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+
+	now := time.Now()
+	haloForZelda := createTestOffer(t, d, alice, halo, bob, zelda, Pending, now)
+	fableForZelda := createTestOffer(t, d, alice, fable, bob, zelda, Pending, now)
+	createTestOffer(t, d, alice, halo, bob, zelda, Rejected, now)
+
+	tests := []struct {
+		gameIds  []int
+		expected []int
+	}{
+		{[]int{halo}, []int{haloForZelda}},
+		{[]int{zelda}, []int{haloForZelda, fableForZelda}},
+		{[]int{halo, fable}, []int{haloForZelda, fableForZelda}},
+		{[]int{}, []int{}},
+	}
+	for _, tt := range tests {
+		offers, err := d.GetPendingOffersWithGames(tt.gameIds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := offerIds(offers); !slices.Equal(ids, tt.expected) {
+			t.Errorf("expected the pending offers for %v to be %v, got %v", tt.gameIds, tt.expected, ids)
+		}
+	}
+
+	// A claim skips the offers another transaction has locked
+	first, err := d.conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Rollback()
+	_, err = (&SQLDatastore{conn: d.conn, db: first}).GetOfferForUpdate(haloForZelda)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := d.ClaimPendingOffersWithGames([]int{zelda})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := offerIds(claimed); !slices.Equal(ids, []int{fableForZelda}) {
+		t.Errorf("expected to claim only the unlocked offer %v, got %v", fableForZelda, ids)
+	}
+}
+
+func TestOfferEvents(t *testing.T) {
+	d := openTestDatastore(t)
+
+	alice := createTestUser(t, d, "Alice")
+	bob := createTestUser(t, d, "Bob")
+	halo := createTestGame(t, d, alice, "Halo", 2001, Good)
+	zelda := createTestGame(t, d, bob, "Zelda", 1986, Mint)
+	offerId := createTestOffer(t, d, alice, halo, bob, zelda, Pending, time.Now())
+
+	pending, reason := Pending, "expired at 2024-03-08T12:00:00Z"
+	for _, event := range []*OfferEvent{
+		{OfferId: offerId, ToStatus: Pending, ActorUserId: &alice},
+		{OfferId: offerId, FromStatus: &pending, ToStatus: Expired, Reason: &reason},
+	} {
+		err := d.CreateOfferEvent(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	offerEvents, err := d.GetOfferEvents(offerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerEvents) != 2 {
+		t.Fatalf("expected 2 events, got %v", len(offerEvents))
+	}
+	created, expired := offerEvents[0], offerEvents[1]
+	if created.FromStatus != nil || created.ToStatus != Pending || *created.ActorUserId != alice || created.Reason != nil || created.CreatedAt == nil {
+		t.Errorf("unexpected creation event %+v", created)
+	}
+	if *expired.FromStatus != Pending || expired.ToStatus != Expired || expired.ActorUserId != nil || *expired.Reason != reason {
+		t.Errorf("unexpected expiry event %+v", expired)
+	}
+
+	// The events keep the offer from being deleted
+	_, err = d.conn.Exec("DELETE FROM offers WHERE `offerId` = ?", offerId)
+	if err == nil {
+		t.Fatal("expected deleting an offer with events to fail")
+	}
+	offerEvents, err = d.GetOfferEvents(offerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offerEvents) != 2 {
+		t.Errorf("expected the events to be kept, got %v", len(offerEvents))
+	}
+}
+
+func TestClaimOutboxMessagesHoldsBackKeys(t *testing.T) {
+	d := openTestDatastore(t)
+
+	var ids []int
+	for _, key := range []string{"offer-1", "offer-1", "offer-2"} {
+		message := OutboxMessage{Topic: "offer", Key: key, Value: "{}"}
+		err := d.CreateOutboxMessage(&message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, *message.OutboxId)
+	}
+
+	// Claims without a lease, so messages that aren't marked are due again straight away
+	claimedIds := func() []int {
+		t.Helper()
+		messages, err := d.ClaimOutboxMessages(10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claimed := []int{}
+		for _, message := range messages {
+			claimed = append(claimed, *message.OutboxId)
+		}
+		return claimed
+	}
+
+	// The second offer-1 message waits for the first
+	claimed := claimedIds()
+	if !slices.Equal(claimed, []int{ids[0], ids[2]}) {
+		t.Errorf("expected messages %v to be claimed, got %v", []int{ids[0], ids[2]}, claimed)
+	}
+
+	// While the first is backing off after a failure, the second is still held back
+	err := d.MarkOutboxMessageFailed(ids[0], "broker down", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed = claimedIds()
+	if !slices.Equal(claimed, []int{ids[2]}) {
+		t.Errorf("expected only message %v to be claimed, got %v", ids[2], claimed)
+	}
+
+	// Once it's sent, the second is released
+	err = d.MarkOutboxMessageSent(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed = claimedIds()
+	if !slices.Equal(claimed, []int{ids[1], ids[2]}) {
+		t.Errorf("expected messages %v to be claimed, got %v", []int{ids[1], ids[2]}, claimed)
+	}
+}
+
+func TestClaimOutboxMessagesLeasesMessages(t *testing.T) {
+	d := openTestDatastore(t)
+
+	message := OutboxMessage{Topic: "offer", Key: "offer-1", Value: "{}"}
+	err := d.CreateOutboxMessage(&message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := d.ClaimOutboxMessages(10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected the message to be claimed, got %v", len(messages))
+	}
+
+	// A leased message isn't claimed again until it's released
+	messages, err = d.ClaimOutboxMessages(10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 0 {
+		t.Errorf("expected the leased message not to be claimed, got %v", len(messages))
+	}
+
+	err = d.ReleaseOutboxMessage(*message.OutboxId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err = d.ClaimOutboxMessages(10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || *messages[0].OutboxId != *message.OutboxId {
+		t.Errorf("expected the released message to be claimed, got %+v", messages)
+	}
+}
@@ -0,0 +1,168 @@
+package dal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Scans a row selected with gameColumns.
+func scanGame(row scanner) (*Game, error) {
+	var game Game
+	err := row.Scan(&game.GameId, &game.UserId, &game.Name, &game.Publisher, &game.Year, &game.System, &game.Condition, &game.Owners, &game.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// Scans a row selected with offerColumns. The offer's items are loaded separately.
+func scanOffer(row scanner) (*Offer, error) {
+	var offer Offer
+	err := row.Scan(&offer.OfferId, &offer.OffererUserId, &offer.RecipientUserId, &offer.Status, &offer.ParentOfferId, &offer.CreatedAt, &offer.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// The columns behind each sort key
+var sortColumns = map[SortKey]string{
+	SortByName:      "`name`",
+	SortByYear:      "`year`",
+	SortByCondition: "`condition`",
+	SortByCreatedAt: "`createdAt`",
+}
+
+// Adds the condition that selects the rows after or before the page's position and returns the
+// ORDER BY and LIMIT clauses, which take the page's limit as their only argument. Pages before a
+// position are selected in reverse order, so the caller has to reverse them back.
+func keyset(where *conditions, page *Page, idColumn string) (string, error) {
+	column, ok := sortColumns[page.Sort]
+	if !ok {
+		return "", fmt.Errorf("can't sort by %q", page.Sort)
+	}
+	if page.After != nil && page.Before != nil {
+		return "", fmt.Errorf("a page can't be both after and before a position")
+	}
+
+	// Selecting backwards flips the order
+	descending := page.Descending != (page.Before != nil)
+	direction, comparison := " ASC", ">"
+	if descending {
+		direction, comparison = " DESC", "<"
+	}
+
+	position := page.After
+	if page.Before != nil {
+		position = page.Before
+	}
+	if position != nil {
+		where.add("("+column+", "+idColumn+") "+comparison+" (?, ?)", position.Value, position.Id)
+	}
+
+	return " ORDER BY " + column + direction + ", " + idColumn + direction + " LIMIT ?", nil
+}
+
+// Returns where the game falls in the sort order.
+func (g *Game) Position(sort SortKey) Position {
+	position := Position{Id: *g.GameId}
+	switch sort {
+	case SortByName:
+		position.Value = *g.Name
+	case SortByYear:
+		position.Value = *g.Year
+	case SortByCondition:
+		position.Value = conditionRank(*g.Condition)
+	case SortByCreatedAt:
+		position.Value = *g.CreatedAt
+	}
+	return position
+}
+
+// Returns where the offer falls in the sort order. Offers can only be sorted by when they were created.
+func (o *Offer) Position(sort SortKey) Position {
+	return Position{Value: *o.CreatedAt, Id: *o.OfferId}
+}
+
+// Returns the condition's position in the games.condition enum, which is what MySQL sorts and
+// compares enums by.
+func conditionRank(condition GameCondition) int {
+	return slices.Index([]GameCondition{Mint, Good, Fair, Poor}, condition) + 1
+}
+
+// Builds the WHERE clause of a query from conditions that must all hold. Values are always passed as
+// placeholder arguments, never written into the query.
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+// Adds a condition with one ? placeholder for each argument.
+func (c *conditions) add(clause string, args ...interface{}) {
+	c.clauses = append(c.clauses, clause)
+	c.args = append(c.args, args...)
+}
+
+// Adds a condition that the column is one of the values. Does nothing if there are no values.
+func in[T any](c *conditions, column string, values []T) {
+	if len(values) == 0 {
+		return
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	c.add(column+" IN (?"+strings.Repeat(", ?", len(values)-1)+")", args...)
+}
+
+// Returns the WHERE clause, with a leading space, or nothing if there are no conditions.
+func (c *conditions) String() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+// Returns the conditions that select the games matching the filter. A nil filter matches every game.
+func gameConditions(filter *GameFilter) *conditions {
+	where := &conditions{}
+	if filter == nil {
+		return where
+	}
+
+	if filter.UserId != nil {
+		where.add("`userId` = ?", *filter.UserId)
+	}
+	if filter.ExcludeUserId != nil {
+		where.add("`userId` <> ?", *filter.ExcludeUserId)
+	}
+	if filter.Name != nil && *filter.Name != "" {
+		where.add("`name` LIKE ?", "%"+escapeLike(*filter.Name)+"%")
+	}
+	if filter.Query != nil && strings.TrimSpace(*filter.Query) != "" {
+		where.add("MATCH (`name`, `publisher`) AGAINST (? IN NATURAL LANGUAGE MODE)", *filter.Query)
+	}
+	in(where, "`system`", filter.Systems)
+	in(where, "`condition`", filter.Conditions)
+	if filter.Publisher != nil {
+		where.add("`publisher` = ?", *filter.Publisher)
+	}
+	if filter.MinYear != nil {
+		where.add("`year` >= ?", *filter.MinYear)
+	}
+	if filter.MaxYear != nil {
+		where.add("`year` <= ?", *filter.MaxYear)
+	}
+	return where
+}
+
+// Escapes the LIKE wildcards in the value so it only matches itself.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
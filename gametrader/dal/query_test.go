@@ -0,0 +1,102 @@
+package dal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"Zelda", "Zelda"},
+		{"100%", `100\%`},
+		{"Mario_Kart", `Mario\_Kart`},
+		{`C:\Games`, `C:\\Games`},
+		// The backslash is escaped first, so the escapes added for % and _ aren't escaped again
+		{`\%_`, `\\\%\_`},
+		{"", ""},
+	}
+	for _, test := range tests {
+		escaped := escapeLike(test.value)
+		if escaped != test.expected {
+			t.Errorf("expected %q to be escaped as %q, got %q", test.value, test.expected, escaped)
+		}
+	}
+}
+
+func TestGameConditions(t *testing.T) {
+	userId, minYear, maxYear := 7, 1985, 1999
+	name, query, publisher := "50% off_", "zelda link", "Nintendo"
+	blank, spaces := "", "   "
+
+	tests := []struct {
+		name   string
+		filter *GameFilter
+		where  string
+		args   []interface{}
+	}{
+		{"no filter", nil, "", nil},
+		{"empty filter", &GameFilter{}, "", nil},
+		{
+			"name",
+			&GameFilter{Name: &name},
+			" WHERE `name` LIKE ?",
+			[]interface{}{`%50\% off\_%`},
+		},
+		{"blank name", &GameFilter{Name: &blank}, "", nil},
+		{
+			"query",
+			&GameFilter{Query: &query},
+			" WHERE MATCH (`name`, `publisher`) AGAINST (? IN NATURAL LANGUAGE MODE)",
+			[]interface{}{"zelda link"},
+		},
+		{"blank query", &GameFilter{Query: &spaces}, "", nil},
+		{
+			"systems and conditions",
+			&GameFilter{Systems: []string{"NES", "SNES"}, Conditions: []GameCondition{Mint}},
+			" WHERE `system` IN (?, ?) AND `condition` IN (?)",
+			[]interface{}{"NES", "SNES", Mint},
+		},
+		{
+			"years",
+			&GameFilter{MinYear: &minYear, MaxYear: &maxYear},
+			" WHERE `year` >= ? AND `year` <= ?",
+			[]interface{}{1985, 1999},
+		},
+		{
+			"everything",
+			&GameFilter{
+				ExcludeUserId: &userId,
+				Name:          &name,
+				Query:         &query,
+				Systems:       []string{"NES"},
+				Conditions:    []GameCondition{Good, Fair},
+				Publisher:     &publisher,
+				MinYear:       &minYear,
+				MaxYear:       &maxYear,
+			},
+			" WHERE `userId` <> ? AND `name` LIKE ? AND MATCH (`name`, `publisher`) AGAINST (? IN NATURAL LANGUAGE MODE)" +
+				" AND `system` IN (?) AND `condition` IN (?, ?) AND `publisher` = ? AND `year` >= ? AND `year` <= ?",
+			[]interface{}{7, `%50\% off\_%`, "zelda link", "NES", Good, Fair, "Nintendo", 1985, 1999},
+		},
+		{
+			"owner",
+			&GameFilter{UserId: &userId},
+			" WHERE `userId` = ?",
+			[]interface{}{7},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			where := gameConditions(test.filter)
+			if where.String() != test.where {
+				t.Errorf("expected WHERE clause %q, got %q", test.where, where.String())
+			}
+			if !reflect.DeepEqual(where.args, test.args) {
+				t.Errorf("expected args %v, got %v", test.args, where.args)
+			}
+		})
+	}
+}
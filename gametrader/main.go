@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/gin-gonic/gin"
 	middleware "github.com/oapi-codegen/gin-middleware"
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,6 +20,13 @@ import (
 	"github.com/robertjshirts/gobuster/services"
 )
 
+// The environment variable holding the secret access tokens are signed with, and the placeholder
+// older auth configs shipped with, which is never accepted
+const (
+	tokenSecretEnv    = "GAMETRADER_TOKEN_SECRET"
+	placeholderSecret = "change-me-in-production"
+)
+
 var (
 	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "api_http_requests_total",
@@ -50,6 +62,15 @@ func ErrorLoggingMiddleware(c *gin.Context) {
 	}
 }
 
+// Responds to requests rejected by the OpenAPI validator. Missing or invalid credentials are reported
+// as 401 instead of the validator's default 400.
+func ValidationErrorHandler(c *gin.Context, message string, statusCode int) {
+	if strings.Contains(message, "SecurityRequirementsError") {
+		statusCode = http.StatusUnauthorized
+	}
+	c.AbortWithStatusJSON(statusCode, gin.H{"error": message})
+}
+
 func main() {
 	router := gin.Default()
 	router.Use(RequestCounterMiddleware)
@@ -64,6 +85,38 @@ func main() {
 
 	dbConfig := ReadDatabaseConfig("config/database.config")
 	kafkaConfig := ReadSaramaConfig("config/kafka.config")
+	authConfig := ReadAuthConfig("config/auth.config")
+	offersConfig := ReadOffersConfig("config/offers.config")
+
+	// The secret is never committed with the config, so every deployment has to set its own
+	tokenSecret := os.Getenv(tokenSecretEnv)
+	if tokenSecret == "" || tokenSecret == placeholderSecret {
+		log.Fatalf("Set %v to a secret of your own to sign access tokens with", tokenSecretEnv)
+	}
+	tokenTTL, err := time.ParseDuration(authConfig["tokenTTL"])
+	if err != nil {
+		log.Fatal("Invalid tokenTTL in the auth config: \n", err)
+	}
+	offerTTL, err := time.ParseDuration(offersConfig["expiry"])
+	if err != nil {
+		log.Fatal("Invalid expiry in the offers config: \n", err)
+	}
+	if offerTTL <= 0 {
+		log.Fatal("The expiry in the offers config must be positive")
+	}
+	exclusiveHold, err := strconv.ParseBool(offersConfig["exclusiveHold"])
+	if err != nil {
+		log.Fatal("Invalid exclusiveHold in the offers config: \n", err)
+	}
+
+	partitions, err := strconv.ParseInt(kafkaConfig["partitions"], 10, 32)
+	if err != nil {
+		log.Fatal("Invalid partitions in the kafka config: \n", err)
+	}
+	replicationFactor, err := strconv.ParseInt(kafkaConfig["replicationFactor"], 10, 16)
+	if err != nil {
+		log.Fatal("Invalid replicationFactor in the kafka config: \n", err)
+	}
 
 	db, dbErr := dal.Init(dbConfig["user"], dbConfig["password"], dbConfig["protocol"], dbConfig["host"], dbConfig["port"], dbConfig["database"])
 	if dbErr != nil {
@@ -71,12 +124,24 @@ func main() {
 	}
 	defer db.Close()
 
-	service, sErr := services.Init(db, strings.Split(kafkaConfig["brokers"], ","), kafkaConfig["offerTopic"], kafkaConfig["userTopic"])
+	brokers := strings.Split(kafkaConfig["brokers"], ",")
+	err = services.CreateTopics(brokers, []string{kafkaConfig["offerTopic"], kafkaConfig["userTopic"]}, int32(partitions), int16(replicationFactor))
+	if err != nil {
+		log.Fatal("There was an error creating the Kafka topics: \n", err)
+	}
+
+	service, sErr := services.Init(db, brokers, kafkaConfig["offerTopic"], kafkaConfig["userTopic"], tokenSecret, tokenTTL, offerTTL, exclusiveHold)
 	if sErr != nil {
 		log.Fatal("There was an error initializing the services: \n", sErr)
 	}
 	defer service.Close()
 
+	// Publish events written to the outbox and expire stale offers in the background
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go service.RunOutboxRelay(ctx)
+	go service.RunExpirySweeper(ctx)
+
 	router.Use(service.Middleware)
 
 	si := api.Init(service)
@@ -86,7 +151,12 @@ func main() {
 		log.Fatal(sErr)
 	}
 
-	router.Use(middleware.OapiRequestValidator(swagger))
+	router.Use(middleware.OapiRequestValidatorWithOptions(swagger, &middleware.Options{
+		ErrorHandler: ValidationErrorHandler,
+		Options: openapi3filter.Options{
+			AuthenticationFunc: service.Authenticate,
+		},
+	}))
 	api.RegisterHandlers(router, si)
 	router.Run()
 }
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/golang-jwt/jwt/v5"
+	ginmiddleware "github.com/oapi-codegen/gin-middleware"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+const tokenIssuer = "gametrader"
+
+// dummyHash is compared against when no user matches the login email, so a missing account
+// takes as long to reject as a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("gametrader"), bcrypt.DefaultCost)
+
+// ------------------- Auth -------------------//
+
+func (s *Service) Login(credentials *api.PostLogin) (*api.LoginResponse, error) {
+	// Look up the user by email
+	dalUser, err := s.db.GetUserByEmail(credentials.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(credentials.Password))
+		return nil, api.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the password, re-hashing rows that were stored before hashing was introduced
+	if dalUser.Password == nil {
+		return nil, api.ErrUnauthorized
+	}
+	legacy, err := checkPassword(*dalUser.Password, credentials.Password)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		hashed, err := hashPassword(&credentials.Password)
+		if err != nil {
+			return nil, err
+		}
+		err = s.db.UpdateUser(*dalUser.UserId, &dal.User{Password: hashed})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Issue an access token for the user
+	token, err := s.issueToken(*dalUser.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the dal model to the api model
+	login := api.LoginResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(s.tokenTTL.Seconds()),
+		User: api.UserResponse{
+			UserId:  *dalUser.UserId,
+			Email:   *dalUser.Email,
+			Name:    *dalUser.Name,
+			Address: *dalUser.Address,
+		},
+	}
+
+	return &login, nil
+}
+
+// Used by the OpenAPI request validator for operations that declare the bearerAuth security scheme.
+// The token itself is checked by Middleware, so this only has to confirm that it found a valid one.
+func (s *Service) Authenticate(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+	c := ginmiddleware.GetGinContext(ctx)
+	if c == nil {
+		return fmt.Errorf("no request context to authenticate %v", input.SecuritySchemeName)
+	}
+	if _, ok := c.Get(api.ActorIdKey); !ok {
+		return api.ErrUnauthorized
+	}
+	return nil
+}
+
+// ------------------- Helpers -------------------//
+
+// Issues a signed access token identifying the user.
+func (s *Service) issueToken(userId int) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.Itoa(userId),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.tokenTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.tokenSecret)
+}
+
+// Verifies the token's signature, issuer and expiry and returns the userId it was issued to.
+func (s *Service) parseToken(token string) (int, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.tokenSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// Hashes the password with bcrypt. Returns nil if the password is nil so it can be used on patch models.
+func hashPassword(password *string) (*string, error) {
+	if password == nil {
+		return nil, nil
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	converted := string(hashed)
+	return &converted, nil
+}
+
+// Compares a stored password against the one supplied at login. Reports legacy as true when the
+// stored value is a plaintext password from before hashing was introduced and it matched, so the
+// caller can re-hash it. Returns api.ErrUnauthorized when the passwords don't match.
+func checkPassword(stored string, supplied string) (legacy bool, err error) {
+	if _, costErr := bcrypt.Cost([]byte(stored)); costErr != nil {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(supplied)) != 1 {
+			return false, api.ErrUnauthorized
+		}
+		return true, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(stored), []byte(supplied))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, api.ErrUnauthorized
+	}
+	return false, err
+}
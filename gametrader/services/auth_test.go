@@ -0,0 +1,318 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// A Datastore holding users, with games and offers in a fakeTx. Methods the tests don't use aren't
+// implemented.
+type fakeDatastore struct {
+	Datastore
+	users map[int]*dal.User
+	tx    *fakeTx
+	// Whether a transaction is open
+	inTx bool
+}
+
+func (d *fakeDatastore) GetUserByEmail(email string) (*dal.User, error) {
+	for _, user := range d.users {
+		if *user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("no such user")
+}
+
+func (d *fakeDatastore) UpdateUser(id int, user *dal.User) error {
+	if user.Password != nil {
+		d.users[id].Password = user.Password
+	}
+	return nil
+}
+
+func (d *fakeDatastore) GetGame(id int) (*dal.Game, error) {
+	return d.tx.GetGame(id)
+}
+
+func (d *fakeDatastore) GetOffer(id int) (*dal.Offer, error) {
+	return d.tx.GetOfferForUpdate(id)
+}
+
+func (d *fakeDatastore) WithTx(fn func(tx dal.TxStore) error) error {
+	d.inTx = true
+	defer func() { d.inTx = false }()
+	return fn(d.tx)
+}
+
+func newTestService(db Datastore) *Service {
+	return &Service{db: db, tokenSecret: []byte("test-secret"), tokenTTL: time.Hour, offerTTL: 7 * 24 * time.Hour}
+}
+
+// Signs claims with the secret the way issueToken does
+func signToken(t *testing.T, secret string, method jwt.SigningMethod, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseToken(t *testing.T) {
+	s := newTestService(nil)
+	issued, err := s.issueToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(issuer string, expiresAt time.Time) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "42",
+			IssuedAt:  jwt.NewNumericDate(now.Add(-2 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		}
+	}
+	noExpiry := claims(tokenIssuer, now)
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"issued", issued, true},
+		{"signed by hand", signToken(t, "test-secret", jwt.SigningMethodHS256, claims(tokenIssuer, now.Add(time.Hour))), true},
+		{"expired", signToken(t, "test-secret", jwt.SigningMethodHS256, claims(tokenIssuer, now.Add(-time.Hour))), false},
+		{"no expiry", signToken(t, "test-secret", jwt.SigningMethodHS256, noExpiry), false},
+		{"bad signature", signToken(t, "another-secret", jwt.SigningMethodHS256, claims(tokenIssuer, now.Add(time.Hour))), false},
+		{"other signing method", signToken(t, "test-secret", jwt.SigningMethodHS512, claims(tokenIssuer, now.Add(time.Hour))), false},
+		{"other issuer", signToken(t, "test-secret", jwt.SigningMethodHS256, claims("someone-else", now.Add(time.Hour))), false},
+		{"tampered", issued + "x", false},
+		{"not a token", "not-a-token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			userId, err := s.parseToken(test.token)
+			if test.valid && (err != nil || userId != 42) {
+				t.Errorf("expected user 42, got %v, %v", userId, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("expected the token to be rejected, got user %v", userId)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newTestService(nil)
+	issued, err := s.issueToken(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := signToken(t, "test-secret", jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   "42",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	})
+	forged := signToken(t, "another-secret", jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   "42",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		// The actor the handler sees, or "" if the request isn't authenticated
+		actor string
+	}{
+		{"valid token", "Bearer " + issued, http.StatusOK, "42"},
+		// Operations that need a token are rejected later by the OpenAPI validator
+		{"missing token", "", http.StatusOK, ""},
+		{"not a bearer token", "Basic " + issued, http.StatusUnauthorized, ""},
+		{"expired token", "Bearer " + expired, http.StatusUnauthorized, ""},
+		{"bad signature", "Bearer " + forged, http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(s.Middleware)
+			router.GET("/", func(c *gin.Context) {
+				actor := ""
+				if actorId, ok := c.Get(api.ActorIdKey); ok {
+					actor = strconv.Itoa(actorId.(int))
+				}
+				c.String(http.StatusOK, actor)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			response := httptest.NewRecorder()
+			router.ServeHTTP(response, request)
+
+			if response.Code != test.status {
+				t.Errorf("expected status %v, got %v", test.status, response.Code)
+			}
+			if response.Code == http.StatusOK && response.Body.String() != test.actor {
+				t.Errorf("expected actor %q, got %q", test.actor, response.Body.String())
+			}
+		})
+	}
+}
+
+func TestOwnershipChecks(t *testing.T) {
+	// User 1 owns game 10 and user 2 owns game 20, and user 1 has offered game 10 for game 20
+	tx := newFakeTx(map[int]int{10: 1, 20: 2})
+	tx.offers[1] = bundle(1, []int{10}, 2, []int{20})
+	s := newTestService(&fakeDatastore{tx: tx})
+
+	accepted := api.Accepted
+	cancelled := api.Cancelled
+	name := "Renamed"
+
+	tests := []struct {
+		name  string
+		check func() error
+	}{
+		{"update another user", func() error { return s.UpdateUser(2, 1, &api.PatchUser{Name: &name}) }},
+		{"delete another user", func() error { return s.DeleteUser(2, 1) }},
+		{"read another user's preferences", func() error { _, err := s.GetPreferences(2, 1); return err }},
+		{"update another user's preferences", func() error { return s.UpdatePreferences(2, 1, &api.PutPreferences{}) }},
+		{"create a game for another user", func() error {
+			_, err := s.CreateGame(2, &api.PostGame{UserId: 1, Name: "Zelda", Condition: api.Good})
+			return err
+		}},
+		{"update another user's game", func() error { return s.UpdateGame(2, 10, &api.PatchGame{Name: &name}) }},
+		{"delete another user's game", func() error { return s.DeleteGame(2, 10) }},
+		{"make an offer for another user", func() error {
+			_, err := s.CreateOffer(2, &api.PostOffer{OffererUserId: 1, OffererGameIds: []int{10}, RecipientUserId: 2, RecipientGameIds: []int{20}})
+			return err
+		}},
+		{"accept an offer as its offerer", func() error { return s.UpdateOffer(1, 1, &accepted) }},
+		{"cancel an offer as its recipient", func() error { return s.UpdateOffer(2, 1, &cancelled) }},
+		{"accept an offer as a third user", func() error { return s.UpdateOffer(3, 1, &accepted) }},
+		{"counter an offer as its offerer", func() error {
+			_, err := s.CounterOffer(1, 1, &api.PostCounterOffer{OffererGameIds: []int{10}, RecipientGameIds: []int{20}})
+			return err
+		}},
+		{"delete an offer as its recipient", func() error { return s.DeleteOffer(2, 1) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.check()
+			if !errors.Is(err, api.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+
+	// None of the rejected changes touched the offer or the games
+	if tx.offers[1].Status != dal.Pending || len(tx.offerEvents) != 0 || len(tx.outbox) != 0 {
+		t.Errorf("expected the offer to be untouched, got status %v with %v events", tx.offers[1].Status, len(tx.offerEvents))
+	}
+	if *tx.games[10].UserId != 1 || *tx.games[20].UserId != 2 {
+		t.Errorf("expected the games to keep their owners")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	password := "hunter2"
+	hashed, err := hashPassword(&password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		supplied string
+		legacy   bool
+		valid    bool
+	}{
+		{"hashed match", *hashed, "hunter2", false, true},
+		{"hashed mismatch", *hashed, "hunter3", false, false},
+		{"legacy match", "hunter2", "hunter2", true, true},
+		{"legacy mismatch", "hunter2", "hunter3", false, false},
+		// A plaintext password can't be used to log in by supplying its hash
+		{"hash supplied for legacy", "hunter2", *hashed, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			legacy, err := checkPassword(test.stored, test.supplied)
+			if test.valid && err != nil {
+				t.Fatalf("expected the password to match, got %v", err)
+			}
+			if !test.valid && !errors.Is(err, api.ErrUnauthorized) {
+				t.Fatalf("expected api.ErrUnauthorized, got %v", err)
+			}
+			if legacy != test.legacy {
+				t.Errorf("expected legacy %v, got %v", test.legacy, legacy)
+			}
+		})
+	}
+}
+
+func TestLoginRehashesLegacyPasswords(t *testing.T) {
+	userId, email, name, address, password := 1, "alice@example.com", "Alice", "1 Main St", "hunter2"
+	db := &fakeDatastore{users: map[int]*dal.User{
+		1: {UserId: &userId, Email: &email, Name: &name, Address: &address, Password: &password},
+	}}
+	s := newTestService(db)
+
+	// A wrong password is rejected and the plaintext password is left alone
+	_, err := s.Login(&api.PostLogin{Email: email, Password: "hunter3"})
+	if !errors.Is(err, api.ErrUnauthorized) {
+		t.Fatalf("expected api.ErrUnauthorized, got %v", err)
+	}
+	if *db.users[1].Password != "hunter2" {
+		t.Fatalf("expected the password not to be rehashed, got %q", *db.users[1].Password)
+	}
+
+	// The right password logs in and is rewritten as a bcrypt hash
+	login, err := s.Login(&api.PostLogin{Email: email, Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login.User.UserId != 1 {
+		t.Errorf("expected to log in as user 1, got %v", login.User.UserId)
+	}
+	rehashed := *db.users[1].Password
+	if _, err := bcrypt.Cost([]byte(rehashed)); err != nil {
+		t.Fatalf("expected the password to be stored as a bcrypt hash, got %q", rehashed)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(rehashed), []byte("hunter2")) != nil {
+		t.Fatal("expected the stored hash to match the password")
+	}
+
+	// Later logins check the hash and don't rewrite it
+	_, err = s.Login(&api.PostLogin{Email: email, Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *db.users[1].Password != rehashed {
+		t.Error("expected the hashed password not to be rewritten")
+	}
+	_, err = s.Login(&api.PostLogin{Email: email, Password: "hunter3"})
+	if !errors.Is(err, api.ErrUnauthorized) {
+		t.Fatalf("expected api.ErrUnauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// Builds an event carrying a snapshot of the user as it is inside the transaction.
+func newUserEvent(tx dal.TxStore, eventType string, actorId int, userId int) (*events.Envelope, error) {
+	event, err := events.NewEnvelope(eventType, &actorId)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userSnapshot(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	event.User = user
+
+	return event, nil
+}
+
+// Builds an event carrying a snapshot of the offer, its users and its games as they are inside the
+// transaction. The actor is nil for changes nobody asked for, like expiry.
+func newOfferEvent(tx dal.TxStore, eventType string, actorId *int, offer *dal.Offer) (*events.Envelope, error) {
+	event, err := events.NewEnvelope(eventType, actorId)
+	if err != nil {
+		return nil, err
+	}
+
+	offerer, err := userSnapshot(tx, *offer.OffererUserId)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := userSnapshot(tx, *offer.RecipientUserId)
+	if err != nil {
+		return nil, err
+	}
+	offererGames, err := gameSnapshots(tx, offer.OffererGameIds)
+	if err != nil {
+		return nil, err
+	}
+	recipientGames, err := gameSnapshots(tx, offer.RecipientGameIds)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Offer = &events.Offer{
+		OfferId:        *offer.OfferId,
+		Status:         string(offer.Status),
+		Offerer:        *offerer,
+		Recipient:      *recipient,
+		OffererGames:   offererGames,
+		RecipientGames: recipientGames,
+		ParentOfferId:  offer.ParentOfferId,
+	}
+
+	return event, nil
+}
+
+func userSnapshot(tx dal.TxStore, userId int) (*events.User, error) {
+	user, err := tx.GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &events.User{
+		UserId: *user.UserId,
+		Email:  *user.Email,
+		Name:   *user.Name,
+	}, nil
+}
+
+func gameSnapshot(tx dal.TxStore, gameId int) (*events.Game, error) {
+	game, err := tx.GetGame(gameId)
+	if err != nil {
+		return nil, err
+	}
+	return &events.Game{
+		GameId:    *game.GameId,
+		Name:      *game.Name,
+		Publisher: *game.Publisher,
+		Year:      *game.Year,
+		System:    *game.System,
+		Condition: string(*game.Condition),
+	}, nil
+}
+
+func gameSnapshots(tx dal.TxStore, gameIds []int) ([]events.Game, error) {
+	games := []events.Game{}
+	for _, gameId := range gameIds {
+		game, err := gameSnapshot(tx, gameId)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, *game)
+	}
+	return games, nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+const (
+	expirySweepInterval = time.Minute
+	expiryBatchSize     = 100
+)
+
+// Returns when an offer made at the given time expires: the requested time, which has to be in the
+// future, or the default lifetime from now.
+func offerExpiry(requested *time.Time, now time.Time, ttl time.Duration) (time.Time, error) {
+	if requested == nil {
+		return now.Add(ttl), nil
+	}
+	if !requested.After(now) {
+		return time.Time{}, fmt.Errorf("%w: offers can't expire in the past", api.ErrBadRequest)
+	}
+	return requested.UTC(), nil
+}
+
+// Expires pending offers as they pass their expiry until the context is cancelled.
+func (s *Service) RunExpirySweeper(ctx context.Context) {
+	ticker := time.NewTicker(expirySweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Keep sweeping while there are full batches waiting
+		for {
+			swept, err := s.sweepExpiredOffers(time.Now().UTC())
+			if err != nil {
+				fmt.Printf("Error expiring offers: %v\n", err)
+				break
+			}
+			if swept < expiryBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// Expires one batch of offers that are past their expiry and returns how many were claimed. Each
+// offer is expired and its event queued in the same transaction that claimed it, so an offer being
+// accepted at the same time is either expired or accepted, never both.
+func (s *Service) sweepExpiredOffers(now time.Time) (int, error) {
+	var claimed int
+	err := s.db.WithTx(func(tx dal.TxStore) error {
+		offers, err := tx.ClaimExpiredOffers(now, expiryBatchSize)
+		if err != nil {
+			return err
+		}
+		claimed = len(offers)
+
+		for _, offer := range offers {
+			err := expireOffer(tx, s.offerTopic, &offer)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// Marks a claimed offer as expired and queues the event, which has no actor.
+func expireOffer(tx dal.TxStore, topic string, offer *dal.Offer) error {
+	err := transitionOffer(tx, offer, dal.Expired, nil, "expired at "+offer.ExpiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	event, err := newOfferEvent(tx, events.Expired, nil, offer)
+	if err != nil {
+		return err
+	}
+	return enqueueEvent(tx, topic, event)
+}
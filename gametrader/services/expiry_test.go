@@ -0,0 +1,111 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+func TestOfferExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	expiresAt, err := offerExpiry(nil, now, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(now.Add(week)) {
+		t.Errorf("expected the default expiry %v, got %v", now.Add(week), expiresAt)
+	}
+
+	tomorrow := now.Add(24 * time.Hour)
+	expiresAt, err = offerExpiry(&tomorrow, now, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(tomorrow) {
+		t.Errorf("expected the requested expiry %v, got %v", tomorrow, expiresAt)
+	}
+
+	for _, past := range []time.Time{now, now.Add(-time.Minute)} {
+		_, err = offerExpiry(&past, now, week)
+		if !errors.Is(err, api.ErrBadRequest) {
+			t.Errorf("expected ErrBadRequest for an expiry at %v, got %v", past, err)
+		}
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	expiresAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	offer := bundle(1, []int{1}, 2, []int{4})
+	offer.ExpiresAt = &expiresAt
+
+	if err := checkExpiry(offer, expiresAt.Add(-time.Second)); err != nil {
+		t.Errorf("expected an offer before its expiry to be live, got %v", err)
+	}
+	if err := checkExpiry(offer, expiresAt); !errors.Is(err, api.ErrConflict) {
+		t.Errorf("expected ErrConflict at the expiry, got %v", err)
+	}
+
+	// Offers that are no longer pending are left to checkTransition
+	offer.Status = dal.Accepted
+	if err := checkExpiry(offer, expiresAt.Add(time.Hour)); err != nil {
+		t.Errorf("expected no error for an accepted offer, got %v", err)
+	}
+}
+
+func TestExpireOffer(t *testing.T) {
+	tx := newFakeTx(map[int]int{1: 1, 4: 2})
+	expiresAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	offer := bundle(1, []int{1}, 2, []int{4})
+	offer.ExpiresAt = &expiresAt
+	_, err := tx.CreateOffer(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := tx.ClaimExpiredOffers(expiresAt, expiryBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 1 {
+		t.Fatalf("expected to claim the offer, got %v", len(claimed))
+	}
+	err = expireOffer(tx, "offer", &claimed[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tx.offers[*offer.OfferId].Status != dal.Expired {
+		t.Errorf("expected the offer to be expired, got %v", tx.offers[*offer.OfferId].Status)
+	}
+	if len(tx.outbox) != 1 {
+		t.Fatalf("expected one event, got %v", len(tx.outbox))
+	}
+	var event events.Envelope
+	err = json.Unmarshal([]byte(tx.outbox[0].Value), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != events.Expired || event.ActorId != nil || event.Offer.Status != string(dal.Expired) {
+		t.Errorf("expected an expired event without an actor, got %+v", event)
+	}
+	if len(tx.offerEvents) != 1 || tx.offerEvents[0].ToStatus != dal.Expired || tx.offerEvents[0].ActorUserId != nil {
+		t.Errorf("expected the expiry to be audited without an actor, got %+v", tx.offerEvents)
+	}
+
+	// An offer can only expire once
+	claimed, err = tx.ClaimExpiredOffers(expiresAt, expiryBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("expected nothing left to claim, got %v", len(claimed))
+	}
+}
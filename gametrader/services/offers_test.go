@@ -0,0 +1,420 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// An in-memory TxStore holding games and offers
+type fakeTx struct {
+	games  map[int]*dal.Game
+	offers map[int]*dal.Offer
+	// The gameIds in the order they were locked
+	locked      []int
+	offerEvents []dal.OfferEvent
+	outbox      []dal.OutboxMessage
+	// The outboxIds of the messages that were sent, that are leased, and that failed with how long
+	// they back off for
+	sent   []int
+	leased map[int]bool
+	failed map[int]time.Duration
+}
+
+func newFakeTx(owners map[int]int) *fakeTx {
+	tx := &fakeTx{games: map[int]*dal.Game{}, offers: map[int]*dal.Offer{}, leased: map[int]bool{}, failed: map[int]time.Duration{}}
+	for gameId, userId := range owners {
+		gameId, userId := gameId, userId
+		name, publisher, system, year, condition := fmt.Sprintf("Game %v", gameId), "Nintendo", "NES", 1986, dal.Good
+		tx.games[gameId] = &dal.Game{GameId: &gameId, UserId: &userId, Name: &name, Publisher: &publisher, Year: &year, System: &system, Condition: &condition}
+	}
+	return tx
+}
+
+func (tx *fakeTx) GetUser(id int) (*dal.User, error) {
+	email, name := fmt.Sprintf("user%v@example.com", id), fmt.Sprintf("User %v", id)
+	return &dal.User{UserId: &id, Email: &email, Name: &name}, nil
+}
+func (tx *fakeTx) UpdateUser(id int, user *dal.User) error { return nil }
+
+func (tx *fakeTx) GetGame(id int) (*dal.Game, error) {
+	game, ok := tx.games[id]
+	if !ok {
+		return nil, errors.New("no such game")
+	}
+	copied := *game
+	return &copied, nil
+}
+
+func (tx *fakeTx) GetGameForUpdate(id int) (*dal.Game, error) {
+	tx.locked = append(tx.locked, id)
+	return tx.GetGame(id)
+}
+
+func (tx *fakeTx) ChangeGameUserId(id int, userId int) error {
+	tx.games[id].UserId = &userId
+	return nil
+}
+
+func (tx *fakeTx) GetOfferForUpdate(id int) (*dal.Offer, error) {
+	offer, ok := tx.offers[id]
+	if !ok {
+		return nil, errors.New("no such offer")
+	}
+	copied := *offer
+	return &copied, nil
+}
+
+func (tx *fakeTx) CreateOffer(offer *dal.Offer) (*dal.Offer, error) {
+	id := len(tx.offers) + 1
+	offer.OfferId = &id
+	copied := *offer
+	tx.offers[id] = &copied
+	return offer, nil
+}
+
+func (tx *fakeTx) UpdateOffer(id int, offer *dal.Offer) error {
+	tx.offers[id].Status = offer.Status
+	return nil
+}
+
+func (tx *fakeTx) ClaimExpiredOffers(now time.Time, limit int) ([]dal.Offer, error) {
+	offers := []dal.Offer{}
+	for _, offer := range tx.offers {
+		if offer.Status == dal.Pending && !offer.ExpiresAt.After(now) && len(offers) < limit {
+			offers = append(offers, *offer)
+		}
+	}
+	return offers, nil
+}
+
+func (tx *fakeTx) GetPendingOffersWithGames(gameIds []int) ([]dal.Offer, error) {
+	offers := []dal.Offer{}
+	for id := 1; id <= len(tx.offers); id++ {
+		offer := tx.offers[id]
+		items := append(slices.Clone(offer.OffererGameIds), offer.RecipientGameIds...)
+		if offer.Status == dal.Pending && slices.ContainsFunc(items, func(gameId int) bool { return slices.Contains(gameIds, gameId) }) {
+			offers = append(offers, *offer)
+		}
+	}
+	return offers, nil
+}
+
+func (tx *fakeTx) ClaimPendingOffersWithGames(gameIds []int) ([]dal.Offer, error) {
+	return tx.GetPendingOffersWithGames(gameIds)
+}
+
+func (tx *fakeTx) CreateOfferEvent(event *dal.OfferEvent) error {
+	tx.offerEvents = append(tx.offerEvents, *event)
+	return nil
+}
+
+func (tx *fakeTx) CreateOutboxMessage(message *dal.OutboxMessage) error {
+	id := len(tx.outbox) + 1
+	message.OutboxId = &id
+	tx.outbox = append(tx.outbox, *message)
+	return nil
+}
+
+// Claims unsent messages in order, holding back messages while an earlier one with the same key is
+// unsent. Leased and failed messages aren't due.
+func (tx *fakeTx) ClaimOutboxMessages(limit int, lease time.Duration) ([]dal.OutboxMessage, error) {
+	var messages []dal.OutboxMessage
+	unsent := map[string]bool{}
+	for _, message := range tx.outbox {
+		id := *message.OutboxId
+		if slices.Contains(tx.sent, id) {
+			continue
+		}
+		_, failed := tx.failed[id]
+		if len(messages) < limit && !unsent[message.Topic+message.Key] && !tx.leased[id] && !failed {
+			tx.leased[id] = true
+			messages = append(messages, message)
+		}
+		unsent[message.Topic+message.Key] = true
+	}
+	return messages, nil
+}
+
+func (tx *fakeTx) MarkOutboxMessageSent(id int) error {
+	tx.sent = append(tx.sent, id)
+	delete(tx.leased, id)
+	return nil
+}
+
+func (tx *fakeTx) MarkOutboxMessageFailed(id int, reason string, retryIn time.Duration) error {
+	tx.outbox[id-1].Attempts++
+	tx.failed[id] = retryIn
+	delete(tx.leased, id)
+	return nil
+}
+
+func (tx *fakeTx) ReleaseOutboxMessage(id int) error {
+	delete(tx.leased, id)
+	return nil
+}
+
+func bundle(offerer int, offererGames []int, recipient int, recipientGames []int) *dal.Offer {
+	return &dal.Offer{
+		OffererUserId:    &offerer,
+		RecipientUserId:  &recipient,
+		OffererGameIds:   offererGames,
+		RecipientGameIds: recipientGames,
+		Status:           dal.Pending,
+	}
+}
+
+// Decodes the event queued in the outbox message and returns its type
+func outboxEventType(t *testing.T, message dal.OutboxMessage) string {
+	t.Helper()
+	var event events.Envelope
+	err := json.Unmarshal([]byte(message.Value), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event.Type
+}
+
+func TestValidateOffer(t *testing.T) {
+	// Games 1-3 belong to user 1 and games 4-5 to user 2
+	owners := map[int]int{1: 1, 2: 1, 3: 1, 4: 2, 5: 2}
+
+	tests := []struct {
+		name  string
+		offer *dal.Offer
+		valid bool
+	}{
+		{"one for one", bundle(1, []int{1}, 2, []int{4}), true},
+		{"three for two", bundle(1, []int{1, 2, 3}, 2, []int{4, 5}), true},
+		{"same user", bundle(1, []int{1}, 1, []int{2}), false},
+		{"nothing offered", bundle(1, []int{}, 2, []int{4}), false},
+		{"nothing requested", bundle(1, []int{1}, 2, []int{}), false},
+		{"game listed twice", bundle(1, []int{1, 1}, 2, []int{4}), false},
+		{"game on both sides", bundle(1, []int{1, 4}, 2, []int{4}), false},
+		{"offerer doesn't own one", bundle(1, []int{1, 5}, 2, []int{4}), false},
+		{"recipient doesn't own one", bundle(1, []int{1}, 2, []int{4, 2}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOffer(newFakeTx(owners), tt.offer)
+			if tt.valid && err != nil {
+				t.Fatalf("expected a valid offer, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, api.ErrConflict) {
+				t.Fatalf("expected ErrConflict, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExecuteOfferTransfersEveryGame(t *testing.T) {
+	tx := newFakeTx(map[int]int{3: 1, 1: 1, 5: 2, 2: 2})
+
+	err := executeOffer(tx, bundle(1, []int{3, 1}, 2, []int{5, 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for gameId, owner := range map[int]int{1: 2, 3: 2, 2: 1, 5: 1} {
+		if *tx.games[gameId].UserId != owner {
+			t.Errorf("expected game %v to belong to user %v, got %v", gameId, owner, *tx.games[gameId].UserId)
+		}
+	}
+	if len(tx.locked) != 4 || tx.locked[0] != 1 || tx.locked[1] != 2 || tx.locked[2] != 3 || tx.locked[3] != 5 {
+		t.Errorf("expected the games to be locked in gameId order, got %v", tx.locked)
+	}
+}
+
+func TestExecuteOfferTransfersNothingIfAGameWasTradedAway(t *testing.T) {
+	// Game 3 has since been traded to user 3
+	tx := newFakeTx(map[int]int{1: 1, 3: 3, 4: 2})
+
+	err := executeOffer(tx, bundle(1, []int{1, 3}, 2, []int{4}))
+	if !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	for gameId, owner := range map[int]int{1: 1, 3: 3, 4: 2} {
+		if *tx.games[gameId].UserId != owner {
+			t.Errorf("expected game %v to still belong to user %v, got %v", gameId, owner, *tx.games[gameId].UserId)
+		}
+	}
+}
+
+func TestAcceptOffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		owners map[int]int
+		status dal.StatusCondition
+		err    error
+		// The type of the event queued for the change
+		event string
+	}{
+		{"accepted", map[int]int{1: 1, 2: 2}, dal.Accepted, nil, events.Accepted},
+		// Game 1 has been traded to user 3 since user 1 offered it
+		{"offered game traded away", map[int]int{1: 3, 2: 2}, dal.Rejected, api.ErrConflict, events.Rejected},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := newFakeTx(test.owners)
+			offer, err := tx.CreateOffer(bundle(1, []int{1}, 2, []int{2}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newTestService(&fakeDatastore{tx: tx})
+
+			accepted := api.Accepted
+			err = s.UpdateOffer(2, *offer.OfferId, &accepted)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if tx.offers[1].Status != test.status {
+				t.Errorf("expected the offer to be %v, got %v", test.status, tx.offers[1].Status)
+			}
+			if len(tx.outbox) != 1 || outboxEventType(t, tx.outbox[0]) != test.event {
+				t.Errorf("expected a %v event in the outbox, got %v", test.event, tx.outbox)
+			}
+		})
+	}
+}
+
+func TestAcceptingAnOfferForAGameTradedAwayRejectsIt(t *testing.T) {
+	// Game 3 has been traded to user 3 since user 1 offered it
+	tx := newFakeTx(map[int]int{1: 1, 3: 3, 4: 2})
+	offer, err := tx.CreateOffer(bundle(1, []int{1, 3}, 2, []int{4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestService(&fakeDatastore{tx: tx})
+	s.offerTopic = "offer"
+
+	accepted := api.Accepted
+	err = s.UpdateOffer(2, *offer.OfferId, &accepted)
+	if !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+
+	if tx.offers[*offer.OfferId].Status != dal.Rejected {
+		t.Errorf("expected the offer to be rejected, got %v", tx.offers[*offer.OfferId].Status)
+	}
+	if len(tx.offerEvents) != 1 || tx.offerEvents[0].ToStatus != dal.Rejected || *tx.offerEvents[0].ActorUserId != 2 {
+		t.Errorf("expected the rejection to be audited with the recipient as its actor, got %+v", tx.offerEvents)
+	}
+
+	// Both users are told the offer was rejected
+	if len(tx.outbox) != 1 || tx.outbox[0].Topic != "offer" {
+		t.Fatalf("expected one event on the offer topic, got %+v", tx.outbox)
+	}
+	var event events.Envelope
+	err = json.Unmarshal([]byte(tx.outbox[0].Value), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != events.Rejected || event.ActorId == nil || *event.ActorId != 2 || event.Offer.Status != string(dal.Rejected) {
+		t.Errorf("expected a rejected event from the recipient, got %+v", event)
+	}
+}
+
+func TestNewCounterOffer(t *testing.T) {
+	parentId := 7
+	parent := bundle(1, []int{1}, 2, []int{4})
+	parent.OfferId = &parentId
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	parent.ExpiresAt = &expiresAt
+
+	counter, err := newCounterOffer(2, parent, []int{4, 5}, []int{1, 2}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *counter.OffererUserId != 2 || *counter.RecipientUserId != 1 {
+		t.Errorf("expected the counter-offer to go from user 2 to user 1, got %v to %v", *counter.OffererUserId, *counter.RecipientUserId)
+	}
+	if counter.Status != dal.Pending || counter.ParentOfferId == nil || *counter.ParentOfferId != parentId {
+		t.Errorf("expected a pending counter-offer to offer %v, got %+v", parentId, counter)
+	}
+
+	// Only the recipient can counter
+	_, err = newCounterOffer(1, parent, []int{1}, []int{4}, now)
+	if !errors.Is(err, api.ErrForbidden) {
+		t.Errorf("expected ErrForbidden when the offerer counters, got %v", err)
+	}
+
+	// Offers past their expiry can't be countered, even before they're swept
+	_, err = newCounterOffer(2, parent, []int{4}, []int{1}, expiresAt)
+	if !errors.Is(err, api.ErrConflict) {
+		t.Errorf("expected ErrConflict when countering an expired offer, got %v", err)
+	}
+
+	// Only pending offers can be countered
+	parent.Status = dal.Accepted
+	_, err = newCounterOffer(2, parent, []int{4}, []int{1}, now)
+	if !errors.Is(err, api.ErrConflict) {
+		t.Errorf("expected ErrConflict when countering an accepted offer, got %v", err)
+	}
+}
+
+func TestCheckHolds(t *testing.T) {
+	tx := newFakeTx(map[int]int{1: 1, 2: 1, 4: 2, 5: 2})
+	held, err := tx.CreateOffer(bundle(1, []int{1}, 2, []int{4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = checkHolds(tx, bundle(1, []int{2}, 2, []int{5}), nil)
+	if err != nil {
+		t.Errorf("expected games in no other offer to be free, got %v", err)
+	}
+	err = checkHolds(tx, bundle(1, []int{2}, 2, []int{4}), nil)
+	if !errors.Is(err, api.ErrConflict) {
+		t.Errorf("expected ErrConflict for a game held by offer %v, got %v", *held.OfferId, err)
+	}
+	err = checkHolds(tx, bundle(2, []int{4}, 1, []int{1}), held.OfferId)
+	if err != nil {
+		t.Errorf("expected the games of the excluded offer to be free, got %v", err)
+	}
+}
+
+func TestCancelConflictingOffers(t *testing.T) {
+	// User 1 has games 1-2, user 2 has game 4 and user 3 has game 6
+	tx := newFakeTx(map[int]int{1: 1, 2: 1, 4: 2, 6: 3})
+	accepted, _ := tx.CreateOffer(bundle(1, []int{1}, 2, []int{4}))
+	sameOfferer, _ := tx.CreateOffer(bundle(1, []int{1, 2}, 3, []int{6}))
+	sameRecipient, _ := tx.CreateOffer(bundle(3, []int{6}, 2, []int{4}))
+	unrelated, _ := tx.CreateOffer(bundle(1, []int{2}, 3, []int{6}))
+	finished, _ := tx.CreateOffer(bundle(3, []int{6}, 1, []int{1}))
+	tx.offers[*finished.OfferId].Status = dal.Rejected
+
+	err := cancelConflictingOffers(tx, "offer", 2, accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[*dal.Offer]dal.StatusCondition{
+		accepted:      dal.Pending,
+		sameOfferer:   dal.Cancelled,
+		sameRecipient: dal.Cancelled,
+		unrelated:     dal.Pending,
+		finished:      dal.Rejected,
+	}
+	for offer, status := range expected {
+		if got := tx.offers[*offer.OfferId].Status; got != status {
+			t.Errorf("expected offer %v to be %v, got %v", *offer.OfferId, status, got)
+		}
+	}
+	if len(tx.outbox) != 2 {
+		t.Errorf("expected an event for each cancelled offer, got %v", len(tx.outbox))
+	}
+	if len(tx.offerEvents) != 2 || tx.offerEvents[0].Reason == nil || *tx.offerEvents[0].Reason != "offer 1 traded one of its games" {
+		t.Errorf("expected each cancellation to be audited with the accepted offer, got %+v", tx.offerEvents)
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+const (
+	outboxPollInterval = time.Second
+	outboxBatchSize    = 100
+	outboxMaxBackoff   = 5 * time.Minute
+	// How long a claimed batch has to be published before another relay may claim it again
+	outboxLease = time.Minute
+)
+
+// Writes an event to the outbox as part of the surrounding transaction. The relay publishes it to
+// Kafka once the transaction has committed.
+func enqueueEvent(tx dal.TxStore, topic string, event *events.Envelope) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.CreateOutboxMessage(&dal.OutboxMessage{
+		Topic: topic,
+		Key:   event.Key(),
+		Value: string(value),
+	})
+}
+
+// Publishes messages from the outbox to Kafka until the context is cancelled.
+func (s *Service) RunOutboxRelay(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Keep relaying while there are full batches waiting
+		for {
+			relayed, err := s.relayOutbox()
+			if err != nil {
+				fmt.Printf("Error relaying outbox: %v\n", err)
+				break
+			}
+			if relayed < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// Publishes one batch of due messages and returns how many were claimed. The batch is leased in one
+// short transaction and published after it commits, so no connection or row locks are held while
+// waiting on Kafka, and the outcome is recorded in a second transaction. The batch stops at the
+// first failure: the failed message is retried with exponential backoff and the rest are released
+// for the next poll. Messages written after a message with the same key are held back until it's
+// published, so each offer's or user's events reach Kafka in the order they were written, but
+// messages for other keys can overtake it. If the relay dies before recording the outcome, the
+// messages are published again once their lease has passed.
+func (s *Service) relayOutbox() (int, error) {
+	var messages []dal.OutboxMessage
+	err := s.db.WithTx(func(tx dal.TxStore) error {
+		var err error
+		messages, err = tx.ClaimOutboxMessages(outboxBatchSize, outboxLease)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var failure error
+	for _, message := range messages {
+		_, _, failure = s.producer.SendMessage(&sarama.ProducerMessage{
+			Topic: message.Topic,
+			Key:   sarama.StringEncoder(message.Key),
+			Value: sarama.StringEncoder(message.Value),
+		})
+		if failure != nil {
+			break
+		}
+		sent++
+	}
+
+	err = s.db.WithTx(func(tx dal.TxStore) error {
+		for _, message := range messages[:sent] {
+			err := tx.MarkOutboxMessageSent(*message.OutboxId)
+			if err != nil {
+				return err
+			}
+		}
+		if failure == nil {
+			return nil
+		}
+
+		failed := messages[sent]
+		err := tx.MarkOutboxMessageFailed(*failed.OutboxId, failure.Error(), outboxBackoff(failed.Attempts))
+		if err != nil {
+			return err
+		}
+		for _, message := range messages[sent+1:] {
+			err := tx.ReleaseOutboxMessage(*message.OutboxId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Wait for the next poll after a failure
+	if failure != nil {
+		return 0, nil
+	}
+	return len(messages), nil
+}
+
+// Returns how long to wait before retrying a message that has already failed the given number of times.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := time.Second << attempts
+	if attempts > 16 || backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// Returns a service relaying the fakeTx's outbox to the producer
+func newRelayService(tx *fakeTx, producer sarama.SyncProducer) (*Service, *fakeDatastore) {
+	db := &fakeDatastore{tx: tx}
+	s := newTestService(db)
+	s.producer = producer
+	return s, db
+}
+
+func writeOutbox(t *testing.T, tx *fakeTx, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		err := tx.CreateOutboxMessage(&dal.OutboxMessage{Topic: "offer", Key: key, Value: "{}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{4, 16 * time.Second},
+		{8, 256 * time.Second},
+		{9, outboxMaxBackoff},
+		{16, outboxMaxBackoff},
+		// Large shifts would overflow
+		{63, outboxMaxBackoff},
+		{100, outboxMaxBackoff},
+	}
+	for _, test := range tests {
+		backoff := outboxBackoff(test.attempts)
+		if backoff != test.expected {
+			t.Errorf("expected a backoff of %v after %v attempts, got %v", test.expected, test.attempts, backoff)
+		}
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	tx := newFakeTx(nil)
+	producer := mocks.NewSyncProducer(t, nil)
+	s, db := newRelayService(tx, producer)
+	writeOutbox(t, tx, "offer-1", "offer-1", "offer-2")
+
+	// Messages are published after the claim commits
+	var published []string
+	publish := func(message *sarama.ProducerMessage) error {
+		if db.inTx {
+			t.Error("expected the message to be published outside a transaction")
+		}
+		key, _ := message.Key.Encode()
+		published = append(published, string(key))
+		return nil
+	}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(publish)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(publish)
+
+	// The second offer-1 message is held back until the first is sent
+	relayed, err := s.relayOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayed != 2 || !slices.Equal(published, []string{"offer-1", "offer-2"}) || !slices.Equal(tx.sent, []int{1, 3}) {
+		t.Fatalf("expected messages 1 and 3 to be sent, relayed %v and sent %v", relayed, tx.sent)
+	}
+
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(publish)
+	relayed, err = s.relayOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayed != 1 || !slices.Equal(tx.sent, []int{1, 3, 2}) || len(tx.leased) != 0 {
+		t.Errorf("expected message 2 to be sent, relayed %v and sent %v", relayed, tx.sent)
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRelayOutboxStopsAtFirstFailure(t *testing.T) {
+	tx := newFakeTx(nil)
+	producer := mocks.NewSyncProducer(t, nil)
+	s, _ := newRelayService(tx, producer)
+	writeOutbox(t, tx, "offer-1", "offer-2", "offer-3", "offer-1")
+
+	producer.ExpectSendMessageAndSucceed()
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+
+	relayed, err := s.relayOutbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayed != 0 {
+		t.Errorf("expected the relay to wait for the next poll, relayed %v", relayed)
+	}
+
+	// The first message is sent, the second backs off and the third is released without being published
+	if !slices.Equal(tx.sent, []int{1}) {
+		t.Errorf("expected message 1 to be sent, sent %v", tx.sent)
+	}
+	if backoff, ok := tx.failed[2]; !ok || backoff != outboxBackoff(0) || tx.outbox[1].Attempts != 1 {
+		t.Errorf("expected message 2 to back off for %v, got %v after %v attempts", outboxBackoff(0), backoff, tx.outbox[1].Attempts)
+	}
+	if len(tx.leased) != 0 {
+		t.Errorf("expected no messages to stay leased, got %v", tx.leased)
+	}
+
+	// The released message and the offer-1 message that was held back are claimed next
+	claimed, err := tx.ClaimOutboxMessages(outboxBatchSize, outboxLease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, message := range claimed {
+		ids = append(ids, *message.OutboxId)
+	}
+	if !slices.Equal(ids, []int{3, 4}) {
+		t.Errorf("expected messages 3 and 4 to be claimed, got %v", ids)
+	}
+
+	if err := producer.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+const (
+	defaultPageSize = 20
+	// Searches are sorted by when the resources were created unless they ask otherwise
+	defaultSort = string(dal.SortByCreatedAt)
+	// The version of the search response format. Version 1 was a bare array.
+	searchResponseVersion = 2
+)
+
+// What a cursor carries: the sort it was issued for and the position of the row the page continues
+// from. Clients only ever see it base64 encoded.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int    `json:"i"`
+	// Whether the page is before the position rather than after it
+	Before bool `json:"b,omitempty"`
+}
+
+// Builds the page a search asked for from its sort, cursor and limit params. Sorts prefixed with '-'
+// are descending. Returns api.ErrBadRequest if the cursor is malformed or was issued for another sort.
+func parsePage(sort string, encoded *string, limit *int) (*dal.Page, error) {
+	page := &dal.Page{
+		Sort:       dal.SortKey(strings.TrimPrefix(sort, "-")),
+		Descending: strings.HasPrefix(sort, "-"),
+		Limit:      defaultPageSize,
+	}
+	if limit != nil {
+		page.Limit = *limit
+	}
+	if encoded == nil || *encoded == "" {
+		return page, nil
+	}
+
+	c, err := decodeCursor(*encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", api.ErrBadRequest)
+	}
+	if c.Sort != sort {
+		return nil, fmt.Errorf("%w: cursor was issued for sort %v, not %v", api.ErrBadRequest, c.Sort, sort)
+	}
+	value, err := positionValue(page.Sort, c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", api.ErrBadRequest)
+	}
+
+	position := &dal.Position{Value: value, Id: c.Id}
+	if c.Before {
+		page.Before = position
+	} else {
+		page.After = position
+	}
+	return page, nil
+}
+
+// Searches fetch one row more than the page holds, to find out whether there's another page beyond
+// it. Trims that row off and returns the links to the neighbouring pages. Link turns a cursor into a
+// link to the same search continuing from it.
+func paginate[T any](rows []T, page *dal.Page, position func(T) dal.Position, link func(cursor) string) ([]T, api.PageLinks) {
+	var links api.PageLinks
+
+	more := len(rows) > page.Limit
+	if more && page.Before != nil {
+		rows = rows[len(rows)-page.Limit:]
+	} else if more {
+		rows = rows[:page.Limit]
+	}
+	if len(rows) == 0 {
+		return rows, links
+	}
+
+	sort := string(page.Sort)
+	if page.Descending {
+		sort = "-" + sort
+	}
+
+	// Paging backwards came from the next page, and paging forwards from the previous one
+	if more || page.Before != nil {
+		last := position(rows[len(rows)-1])
+		next := link(cursor{Sort: sort, Value: formatPositionValue(last.Value), Id: last.Id})
+		links.Next = &next
+	}
+	if page.After != nil || (more && page.Before != nil) {
+		first := position(rows[0])
+		prev := link(cursor{Sort: sort, Value: formatPositionValue(first.Value), Id: first.Id, Before: true})
+		links.Prev = &prev
+	}
+	return rows, links
+}
+
+// Returns a function that links to the search at path with the given params, continuing from a cursor.
+func searchLink(path string, params interface{}) func(cursor) string {
+	return func(c cursor) string {
+		query := queryValues(params)
+		query.Set("cursor", encodeCursor(c))
+		return path + "?" + query.Encode()
+	}
+}
+
+// Converts generated query params back to the query string they were bound from, using their json
+// tags. Leaves out the cursor, which a link replaces.
+func queryValues(params interface{}) url.Values {
+	query := url.Values{}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return query
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return query
+	}
+
+	for name, value := range fields {
+		if name == "cursor" {
+			continue
+		}
+		if values, ok := value.([]interface{}); ok {
+			for _, value := range values {
+				query.Add(name, formatQueryValue(value))
+			}
+		} else {
+			query.Set(name, formatQueryValue(value))
+		}
+	}
+	return query
+}
+
+func formatQueryValue(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+func encodeCursor(c cursor) string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	err = json.Unmarshal(decoded, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Formats a position's value for a cursor.
+func formatPositionValue(value interface{}) string {
+	switch value := value.(type) {
+	case int:
+		return strconv.Itoa(value)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// Parses a position's value from a cursor back into the type the sort key's column holds.
+func positionValue(sort dal.SortKey, value string) (interface{}, error) {
+	switch sort {
+	case dal.SortByYear, dal.SortByCondition:
+		return strconv.Atoi(value)
+	case dal.SortByCreatedAt:
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	return value, nil
+}
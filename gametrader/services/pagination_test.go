@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+func TestParsePageCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		sort   string
+		cursor cursor
+		value  interface{}
+	}{
+		{"name", cursor{Sort: "name", Value: "Zelda", Id: 20}, "Zelda"},
+		{"-year", cursor{Sort: "-year", Value: "1985", Id: 4, Before: true}, 1985},
+		{"condition", cursor{Sort: "condition", Value: "2", Id: 7}, 2},
+		{"createdAt", cursor{Sort: "createdAt", Value: createdAt.Format(time.RFC3339Nano), Id: 1}, createdAt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+			page, err := parsePage(tt.sort, &encoded, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Limit != defaultPageSize || page.Descending != strings.HasPrefix(tt.sort, "-") {
+				t.Errorf("unexpected page %+v", page)
+			}
+
+			position := page.After
+			if tt.cursor.Before {
+				position = page.Before
+			}
+			if position == nil || position.Value != tt.value || position.Id != tt.cursor.Id {
+				t.Errorf("expected position (%v, %v), got %+v", tt.value, tt.cursor.Id, position)
+			}
+		})
+	}
+}
+
+func TestParsePageRejectsBadCursors(t *testing.T) {
+	otherSort := encodeCursor(cursor{Sort: "name", Value: "Zelda", Id: 20})
+	badValue := encodeCursor(cursor{Sort: "year", Value: "Zelda", Id: 20})
+	for _, encoded := range []string{"not a cursor", otherSort, badValue} {
+		_, err := parsePage("year", &encoded, nil)
+		if !errors.Is(err, api.ErrBadRequest) {
+			t.Errorf("expected ErrBadRequest for cursor %q, got %v", encoded, err)
+		}
+	}
+}
+
+func TestPaginateLinks(t *testing.T) {
+	name := "Zelda"
+	params := &api.GetGamesParams{Name: &name}
+	link := searchLink("/games", params)
+	position := func(id int) dal.Position { return dal.Position{Value: id, Id: id} }
+
+	tests := []struct {
+		name     string
+		page     dal.Page
+		rows     []int
+		expected []int
+		next     *cursor
+		prev     *cursor
+	}{
+		{
+			name:     "first page with more",
+			page:     dal.Page{Sort: dal.SortByYear, Limit: 2},
+			rows:     []int{1, 2, 3},
+			expected: []int{1, 2},
+			next:     &cursor{Sort: "year", Value: "2", Id: 2},
+		},
+		{
+			name:     "only page",
+			page:     dal.Page{Sort: dal.SortByYear, Limit: 2},
+			rows:     []int{1, 2},
+			expected: []int{1, 2},
+		},
+		{
+			name:     "last page",
+			page:     dal.Page{Sort: dal.SortByYear, Limit: 2, After: &dal.Position{Value: 2, Id: 2}},
+			rows:     []int{3},
+			expected: []int{3},
+			prev:     &cursor{Sort: "year", Value: "3", Id: 3, Before: true},
+		},
+		{
+			name:     "backwards with more",
+			page:     dal.Page{Sort: dal.SortByYear, Descending: true, Limit: 2, Before: &dal.Position{Value: 4, Id: 4}},
+			rows:     []int{7, 6, 5},
+			expected: []int{6, 5},
+			next:     &cursor{Sort: "-year", Value: "5", Id: 5},
+			prev:     &cursor{Sort: "-year", Value: "6", Id: 6, Before: true},
+		},
+		{
+			name:     "backwards to the first page",
+			page:     dal.Page{Sort: dal.SortByYear, Limit: 2, Before: &dal.Position{Value: 3, Id: 3}},
+			rows:     []int{1, 2},
+			expected: []int{1, 2},
+			next:     &cursor{Sort: "year", Value: "2", Id: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, links := paginate(tt.rows, &tt.page, position, link)
+			if len(rows) != len(tt.expected) {
+				t.Fatalf("expected rows %v, got %v", tt.expected, rows)
+			}
+			for i := range rows {
+				if rows[i] != tt.expected[i] {
+					t.Fatalf("expected rows %v, got %v", tt.expected, rows)
+				}
+			}
+			checkLink(t, "next", links.Next, tt.next)
+			checkLink(t, "prev", links.Prev, tt.prev)
+		})
+	}
+}
+
+func checkLink(t *testing.T, name string, link *string, expected *cursor) {
+	t.Helper()
+	if expected == nil {
+		if link != nil {
+			t.Errorf("expected no %v link, got %v", name, *link)
+		}
+		return
+	}
+	if link == nil {
+		t.Fatalf("expected a %v link", name)
+	}
+
+	parsed, err := url.Parse(*link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Path != "/games" || parsed.Query().Get("name") != "Zelda" {
+		t.Errorf("expected the %v link to keep the search, got %v", name, *link)
+	}
+	c, err := decodeCursor(parsed.Query().Get("cursor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *c != *expected {
+		t.Errorf("expected %v cursor %+v, got %+v", name, *expected, *c)
+	}
+}
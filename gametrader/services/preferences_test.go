@@ -0,0 +1,76 @@
+package services
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// A Datastore holding users' notification preferences. Methods the tests don't use aren't implemented.
+type fakePreferencesStore struct {
+	Datastore
+	preferences map[int]*dal.NotificationPreferences
+}
+
+func (d *fakePreferencesStore) GetNotificationPreferences(userId int) (*dal.NotificationPreferences, error) {
+	preferences, ok := d.preferences[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *preferences
+	return &copied, nil
+}
+
+func (d *fakePreferencesStore) PutNotificationPreferences(userId int, preferences *dal.NotificationPreferences) error {
+	copied := *preferences
+	d.preferences[userId] = &copied
+	return nil
+}
+
+func TestPreferences(t *testing.T) {
+	tests := []struct {
+		name  string
+		saved *api.PutPreferences
+		// The preferences read back afterwards
+		expected *api.NotificationPreferences
+	}{
+		{"never saved", nil, defaultPreferences()},
+		{"one channel in a digest", &api.PutPreferences{
+			Channels:    []api.NotificationChannelEnum{api.Smtp},
+			MutedEvents: []api.NotificationEventEnum{api.OfferCreated, api.UserUpdated},
+			Delivery:    api.Daily,
+		}, &api.NotificationPreferences{
+			Channels:    []api.NotificationChannelEnum{api.Smtp},
+			MutedEvents: []api.NotificationEventEnum{api.OfferCreated, api.UserUpdated},
+			Delivery:    api.Daily,
+		}},
+		// Empty lists stay empty rather than becoming null
+		{"everything off", &api.PutPreferences{Delivery: api.Immediate}, &api.NotificationPreferences{
+			Channels:    []api.NotificationChannelEnum{},
+			MutedEvents: []api.NotificationEventEnum{},
+			Delivery:    api.Immediate,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestService(&fakePreferencesStore{preferences: map[int]*dal.NotificationPreferences{}})
+			if test.saved != nil {
+				err := s.UpdatePreferences(1, 1, test.saved)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			preferences, err := s.GetPreferences(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(preferences, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, preferences)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package services
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	//"encoding/json"
 
 	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
+	"github.com/robertjshirts/events"
 
 	"github.com/robertjshirts/gobuster/api"
 	"github.com/robertjshirts/gobuster/dal"
@@ -15,33 +21,43 @@ import (
 
 type Datastore interface {
 	GetUser(id int) (*dal.User, error)
+	GetUserByEmail(email string) (*dal.User, error)
 	CreateUser(user *dal.User) (*dal.User, error)
 	UpdateUser(id int, user *dal.User) error
 	DeleteUser(id int) error
+	GetNotificationPreferences(userId int) (*dal.NotificationPreferences, error)
+	PutNotificationPreferences(userId int, preferences *dal.NotificationPreferences) error
 
 	GetGame(id int) (*dal.Game, error)
-	GetGames(userId *int, offset *int, limit *int) ([]dal.Game, error)
+	GetGames(filter *dal.GameFilter, page *dal.Page) ([]dal.Game, error)
 	CreateGame(game *dal.Game) (*dal.Game, error)
 	UpdateGame(id int, game *dal.Game) error
 	DeleteGame(id int) error
 
-	ChangeGameUserId(id int, userId int) error
-
 	GetOffer(id int) (*dal.Offer, error)
-	GetOffers(offererUserId *int, recipientUserId *int, offset *int, limit *int) ([]dal.Offer, error)
+	GetOffers(filter *dal.OfferFilter, page *dal.Page) ([]dal.Offer, error)
+	GetOfferHistory(id int) ([]dal.Offer, error)
+	GetOfferEvents(offerId int) ([]dal.OfferEvent, error)
 	CreateOffer(offer *dal.Offer) (*dal.Offer, error)
 	UpdateOffer(id int, offer *dal.Offer) error
-	DeleteOffer(id int) error
+
+	WithTx(fn func(tx dal.TxStore) error) error
 }
 
 type Service struct {
-	db         Datastore
-	producer   sarama.SyncProducer
-	offerTopic string
-	userTopic  string
+	db          Datastore
+	producer    sarama.SyncProducer
+	offerTopic  string
+	userTopic   string
+	tokenSecret []byte
+	tokenTTL    time.Duration
+	// How long offers stay pending when the offerer doesn't pick an expiry
+	offerTTL time.Duration
+	// Whether a game can only be in one pending offer at a time
+	exclusiveHold bool
 }
 
-func Init(db Datastore, brokers []string, offerTopic string, userTopic string) (*Service, error) {
+func Init(db Datastore, brokers []string, offerTopic string, userTopic string, tokenSecret string, tokenTTL time.Duration, offerTTL time.Duration, exclusiveHold bool) (*Service, error) {
 	config := sarama.NewConfig()
 	config.Version = sarama.V3_3_0_0
 	config.Producer.RequiredAcks = sarama.WaitForAll
@@ -70,26 +86,52 @@ func Init(db Datastore, brokers []string, offerTopic string, userTopic string) (
 
 	fmt.Println("Connected to the Kafka cluster")
 
-	topics := []string{offerTopic, userTopic}
-	for _, topic := range topics {
-		_, _, err := producer.SendMessage(&sarama.ProducerMessage{
-			Topic: topic,
-			Key:   sarama.StringEncoder("init"),
-			Value: sarama.StringEncoder("init"),
-		})
+	return &Service{
+		db:            db,
+		producer:      producer,
+		offerTopic:    offerTopic,
+		userTopic:     userTopic,
+		tokenSecret:   []byte(tokenSecret),
+		tokenTTL:      tokenTTL,
+		offerTTL:      offerTTL,
+		exclusiveHold: exclusiveHold}, nil
+}
 
-		if err != nil {
-			return nil, err
-		}
+// Creates the topics that don't exist yet, so consumers can subscribe to them before anything has
+// been published.
+func CreateTopics(brokers []string, topics []string, partitions int32, replicationFactor int16) error {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_3_0_0
 
-		fmt.Printf("Sent init message to topic %v\n", topic)
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return err
 	}
+	defer admin.Close()
 
-	return &Service{
-		db:         db,
-		producer:   producer,
-		offerTopic: offerTopic,
-		userTopic:  userTopic}, nil
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		if _, ok := existing[topic]; ok {
+			continue
+		}
+		err := admin.CreateTopic(topic, &sarama.TopicDetail{
+			NumPartitions:     partitions,
+			ReplicationFactor: replicationFactor,
+		}, false)
+		// Another replica may have created it since the topics were listed
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("creating topic %v: %w", topic, err)
+		}
+		fmt.Printf("Created topic %v\n", topic)
+	}
+	return nil
 }
 
 func (s *Service) Close() error {
@@ -98,7 +140,30 @@ func (s *Service) Close() error {
 
 // ---------------- Middleware ----------------//
 
+// Validates the bearer token, if the request has one, and stores the caller's userId in the context
+// for the handlers. Requests without a token are passed through; the OpenAPI validator rejects them
+// for operations that require authentication.
 func (s *Service) Middleware(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		c.Next()
+		return
+	}
+
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	userId, err := s.parseToken(token)
+	if err != nil {
+		c.Error(err)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Set(api.ActorIdKey, userId)
 	c.Next()
 }
 
@@ -123,12 +188,18 @@ func (s *Service) GetUser(id api.UserId) (*api.UserResponse, error) {
 }
 
 func (s *Service) CreateUser(user *api.PostUser) (*api.UserResponse, error) {
+	// Hash the password before it reaches the database
+	hashed, err := hashPassword(&user.Password)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert the api model to the dal model (dereference the pointers because its on the createUser method)
 	dalUser := dal.User{
 		Email:    &user.Email,
 		Name:     &user.Name,
 		Address:  &user.Address,
-		Password: &user.Password,
+		Password: hashed,
 	}
 
 	// Call the db method to create the user
@@ -148,41 +219,105 @@ func (s *Service) CreateUser(user *api.PostUser) (*api.UserResponse, error) {
 	return &apiUser, nil
 }
 
-func (s *Service) UpdateUser(id api.UserId, user *api.PatchUser) error {
-	// Convert the api model to the dal model (no need to dereference the pointers because its on the updateUser method)
-	dalUser := dal.User{
-		Name:     user.Name,
-		Address:  user.Address,
-		Password: user.Password,
+func (s *Service) UpdateUser(actorId api.UserId, id api.UserId, user *api.PatchUser) error {
+	// Users may only update themselves
+	if actorId != id {
+		return api.ErrForbidden
 	}
 
-	// Call the db method to update the user
-	err := s.db.UpdateUser(id, &dalUser)
+	// Hash the new password, if there is one
+	hashed, err := hashPassword(user.Password)
 	if err != nil {
 		return err
 	}
 
-	// If the password isn't being updated, return
-	if user.Password == nil {
-		return nil
+	// Convert the api model to the dal model (no need to dereference the pointers because its on the updateUser method)
+	dalUser := dal.User{
+		Name:     user.Name,
+		Address:  user.Address,
+		Password: hashed,
 	}
 
-	// Send password update to the kafka topic
-	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: s.userTopic,
-		Key:   sarama.StringEncoder("updated"),
-		Value: sarama.StringEncoder(fmt.Sprint(id)),
+	// Update the user and, if the password changed, queue the event in the same transaction
+	return s.db.WithTx(func(tx dal.TxStore) error {
+		err := tx.UpdateUser(id, &dalUser)
+		if err != nil {
+			return err
+		}
+
+		// If the password isn't being updated, return
+		if user.Password == nil {
+			return nil
+		}
+
+		event, err := newUserEvent(tx, events.Updated, actorId, id)
+		if err != nil {
+			return err
+		}
+		return enqueueEvent(tx, s.userTopic, event)
 	})
+}
+
+func (s *Service) DeleteUser(actorId api.UserId, id api.UserId) error {
+	// Users may only delete themselves
+	if actorId != id {
+		return api.ErrForbidden
+	}
+
+	return s.db.DeleteUser(id)
+}
+
+func (s *Service) GetPreferences(actorId api.UserId, id api.UserId) (*api.NotificationPreferences, error) {
+	// Preferences are private to the user
+	if actorId != id {
+		return nil, api.ErrForbidden
+	}
 
+	// Users who never saved their preferences get the defaults
+	dalPreferences, err := s.db.GetNotificationPreferences(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultPreferences(), nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	// Convert the dal model to the api model
+	apiPreferences := api.NotificationPreferences{
+		Channels:    []api.NotificationChannelEnum{},
+		MutedEvents: []api.NotificationEventEnum{},
+		Delivery:    api.NotificationDeliveryEnum(dalPreferences.Delivery),
+	}
+	for _, channel := range dalPreferences.Channels {
+		apiPreferences.Channels = append(apiPreferences.Channels, api.NotificationChannelEnum(channel))
+	}
+	for _, event := range dalPreferences.MutedEvents {
+		apiPreferences.MutedEvents = append(apiPreferences.MutedEvents, api.NotificationEventEnum(event))
+	}
+
+	return &apiPreferences, nil
 }
 
-func (s *Service) DeleteUser(id api.UserId) error {
-	return s.db.DeleteUser(id)
+func (s *Service) UpdatePreferences(actorId api.UserId, id api.UserId, preferences *api.PutPreferences) error {
+	// Users may only update their own preferences
+	if actorId != id {
+		return api.ErrForbidden
+	}
+
+	// Convert the api model to the dal model
+	dalPreferences := dal.NotificationPreferences{
+		Channels:    []string{},
+		MutedEvents: []string{},
+		Delivery:    string(preferences.Delivery),
+	}
+	for _, channel := range preferences.Channels {
+		dalPreferences.Channels = append(dalPreferences.Channels, string(channel))
+	}
+	for _, event := range preferences.MutedEvents {
+		dalPreferences.MutedEvents = append(dalPreferences.MutedEvents, string(event))
+	}
+
+	return s.db.PutNotificationPreferences(id, &dalPreferences)
 }
 
 // ------------------- Game -------------------//
@@ -211,18 +346,49 @@ func (s *Service) GetGame(id api.GameId) (*api.GameResponse, error) {
 
 func (s *Service) GetGames(params *api.GetGamesParams) (*api.GameSearchResponse, error) {
 	// Parse search params
-	userId := params.UserId
-	offset := params.Offset
-	limit := params.Limit
+	filter := &dal.GameFilter{
+		UserId:        params.UserId,
+		ExcludeUserId: params.ExcludeUserId,
+		Name:          params.Name,
+		Query:         params.Q,
+		Publisher:     params.Publisher,
+		MinYear:       params.MinYear,
+		MaxYear:       params.MaxYear,
+	}
+	if params.System != nil {
+		filter.Systems = *params.System
+	}
+	if params.Condition != nil {
+		for _, condition := range *params.Condition {
+			filter.Conditions = append(filter.Conditions, dal.GameCondition(condition))
+		}
+	}
+	sort := defaultSort
+	if params.Sort != nil {
+		sort = string(*params.Sort)
+	}
+	page, err := parsePage(sort, params.Cursor, params.Limit)
+	if err != nil {
+		return nil, err
+	}
 
-	// Call the db method to get the games
-	dalGames, err := s.db.GetGames(userId, offset, limit)
+	// Call the db method to get the games, with one extra to tell if there's a next page
+	fetch := *page
+	fetch.Limit++
+	dalGames, err := s.db.GetGames(filter, &fetch)
 	if err != nil {
 		return nil, err
 	}
+	dalGames, links := paginate(dalGames, page, func(game dal.Game) dal.Position {
+		return game.Position(page.Sort)
+	}, searchLink("/games", params))
 
 	// Convert the dal model to the api model
-	var apiGames api.GameSearchResponse
+	apiGames := api.GameSearchResponse{
+		Version: searchResponseVersion,
+		Data:    []api.GameResponse{},
+		Links:   links,
+	}
 	for _, game := range dalGames {
 		apiGame := api.GameResponse{
 			GameId:    *game.GameId,
@@ -234,13 +400,18 @@ func (s *Service) GetGames(params *api.GetGamesParams) (*api.GameSearchResponse,
 			Condition: api.GameConditionEnum(*game.Condition),
 			Owners:    game.Owners,
 		}
-		apiGames = append(apiGames, apiGame)
+		apiGames.Data = append(apiGames.Data, apiGame)
 	}
 
 	return &apiGames, nil
 }
 
-func (s *Service) CreateGame(game *api.PostGame) (*api.GameResponse, error) {
+func (s *Service) CreateGame(actorId api.UserId, game *api.PostGame) (*api.GameResponse, error) {
+	// Users may only create games for themselves
+	if game.UserId != actorId {
+		return nil, api.ErrForbidden
+	}
+
 	// Convert the api model to the dal model
 	dalGame := dal.Game{
 		UserId:    &game.UserId,
@@ -273,7 +444,13 @@ func (s *Service) CreateGame(game *api.PostGame) (*api.GameResponse, error) {
 	return &apiGame, nil
 }
 
-func (s *Service) UpdateGame(id api.GameId, game *api.PatchGame) error {
+func (s *Service) UpdateGame(actorId api.UserId, id api.GameId, game *api.PatchGame) error {
+	// Only the owner may update the game
+	err := s.authorizeGameOwner(actorId, id)
+	if err != nil {
+		return err
+	}
+
 	// Convert the api model to the dal model
 	dalGame := dal.Game{
 		Name:      game.Name,
@@ -285,11 +462,17 @@ func (s *Service) UpdateGame(id api.GameId, game *api.PatchGame) error {
 	}
 
 	// Call the db method to update the game
-	err := s.db.UpdateGame(id, &dalGame)
+	err = s.db.UpdateGame(id, &dalGame)
 	return err
 }
 
-func (s *Service) DeleteGame(id api.GameId) error {
+func (s *Service) DeleteGame(actorId api.UserId, id api.GameId) error {
+	// Only the owner may delete the game
+	err := s.authorizeGameOwner(actorId, id)
+	if err != nil {
+		return err
+	}
+
 	// Call the db method to delete the game
 	return s.db.DeleteGame(id)
 }
@@ -304,211 +487,613 @@ func (s *Service) GetOffer(id api.OfferId) (*api.OfferResponse, error) {
 	}
 
 	// Convert the dal model to the api model
-	apiOffer := api.OfferResponse{
-		OfferId:         *offer.OfferId,
-		OffererUserId:   "/users/" + fmt.Sprint(*offer.OffererUserId),
-		OffererGameId:   "/games/" + fmt.Sprint(*offer.OffererGameId),
-		RecipientUserId: "/users/" + fmt.Sprint(*offer.RecipientUserId),
-		RecipientGameId: "/games/" + fmt.Sprint(*offer.RecipientGameId),
-		Status:          api.OfferStatusEnum(offer.Status),
-	}
+	apiOffer := s.convertOffer(offer)
 
 	return &apiOffer, nil
 }
 
 func (s *Service) GetOffers(params *api.GetOffersParams) (*api.OfferSearchResponse, error) {
 	// Parse search params
-	offererUserId := params.OffererUserId
-	recipientUserId := params.RecipientUserId
-	offset := params.Offset
-	limit := params.Limit
+	filter := &dal.OfferFilter{
+		OffererUserId:   params.OffererUserId,
+		RecipientUserId: params.RecipientUserId,
+		InvolvingUserId: params.InvolvingUserId,
+		GameId:          params.GameId,
+		CreatedAfter:    params.CreatedAfter,
+		CreatedBefore:   params.CreatedBefore,
+	}
+	if params.Status != nil {
+		for _, status := range *params.Status {
+			filter.Statuses = append(filter.Statuses, dal.StatusCondition(status))
+		}
+	}
+	sort := defaultSort
+	if params.Sort != nil {
+		sort = string(*params.Sort)
+	}
+	page, err := parsePage(sort, params.Cursor, params.Limit)
+	if err != nil {
+		return nil, err
+	}
 
-	// Call the db method to get the offers
-	dalOffers, err := s.db.GetOffers(offererUserId, recipientUserId, offset, limit)
+	// Call the db method to get the offers, with one extra to tell if there's a next page
+	fetch := *page
+	fetch.Limit++
+	dalOffers, err := s.db.GetOffers(filter, &fetch)
 	if err != nil {
 		return nil, err
 	}
+	dalOffers, links := paginate(dalOffers, page, func(offer dal.Offer) dal.Position {
+		return offer.Position(page.Sort)
+	}, searchLink("/offers", params))
 
 	// Convert the dal model to the api model
-	var apiOffers api.OfferSearchResponse
+	apiOffers := api.OfferSearchResponse{
+		Version: searchResponseVersion,
+		Data:    []api.OfferResponse{},
+		Links:   links,
+	}
 	for _, offer := range dalOffers {
-		apiOffer := api.OfferResponse{
-			OfferId:         *offer.OfferId,
-			OffererUserId:   "/users/" + fmt.Sprint(*offer.OffererUserId),
-			OffererGameId:   "/games/" + fmt.Sprint(*offer.OffererGameId),
-			RecipientUserId: "/users/" + fmt.Sprint(*offer.RecipientUserId),
-			RecipientGameId: "/games/" + fmt.Sprint(*offer.RecipientGameId),
-			Status:          api.OfferStatusEnum(offer.Status),
-		}
-		apiOffers = append(apiOffers, apiOffer)
+		apiOffers.Data = append(apiOffers.Data, s.convertOffer(&offer))
 	}
 
 	return &apiOffers, nil
 }
 
-func (s *Service) CreateOffer(offer *api.PostOffer) (*api.OfferResponse, error) {
+func (s *Service) CreateOffer(actorId api.UserId, offer *api.PostOffer) (*api.OfferResponse, error) {
+	// Users may only make offers on their own behalf
+	if offer.OffererUserId != actorId {
+		return nil, api.ErrForbidden
+	}
+
+	expiresAt, err := offerExpiry(offer.ExpiresAt, time.Now().UTC(), s.offerTTL)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert the api model to the dal model
 	dalOffer := dal.Offer{
-		OffererUserId:   &offer.OffererUserId,
-		OffererGameId:   &offer.OffererGameId,
-		RecipientUserId: &offer.RecipientUserId,
-		RecipientGameId: &offer.RecipientGameId,
-		Status:          dal.Pending,
+		OffererUserId:    &offer.OffererUserId,
+		RecipientUserId:  &offer.RecipientUserId,
+		OffererGameIds:   offer.OffererGameIds,
+		RecipientGameIds: offer.RecipientGameIds,
+		Status:           dal.Pending,
+		ExpiresAt:        &expiresAt,
 	}
 
-	// Call the db method to create the offer
-	createdOffer, err := s.db.CreateOffer(&dalOffer)
+	// Create the offer and queue the event in the same transaction
+	var createdOffer *dal.Offer
+	var invalid error
+	err = s.db.WithTx(func(tx dal.TxStore) error {
+		// Refuse games that are held by another pending offer
+		if s.exclusiveHold {
+			err := checkHolds(tx, &dalOffer, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Call the db method to create the offer
+		var err error
+		createdOffer, err = tx.CreateOffer(&dalOffer)
+		if err != nil {
+			return err
+		}
+		err = recordOfferEvent(tx, *createdOffer.OfferId, nil, dal.Pending, &actorId, "")
+		if err != nil {
+			return err
+		}
+
+		// Verify the offer, keeping it as rejected if it's invalid
+		err = validateOffer(tx, createdOffer)
+		if errors.Is(err, api.ErrConflict) {
+			invalid = err
+			return transitionOffer(tx, createdOffer, dal.Rejected, &actorId, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		event, err := newOfferEvent(tx, events.Created, &actorId, createdOffer)
+		if err != nil {
+			return err
+		}
+		return enqueueEvent(tx, s.offerTopic, event)
+	})
 	if err != nil {
 		return nil, err
 	}
+	if invalid != nil {
+		return nil, invalid
+	}
 
-	// Verify the offer
-	err = s.validateOffer(*createdOffer.OfferId)
+	// Convert the dal model to the api model
+	apiOffer := s.convertOffer(createdOffer)
+
+	return &apiOffer, nil
+}
+
+// Creates a counter-offer from the recipient of the offer back to its offerer and marks the offer as
+// countered.
+func (s *Service) CounterOffer(actorId api.UserId, id api.OfferId, counter *api.PostCounterOffer) (*api.OfferResponse, error) {
+	now := time.Now().UTC()
+	expiresAt, err := offerExpiry(counter.ExpiresAt, now, s.offerTTL)
 	if err != nil {
 		return nil, err
 	}
 
-	// Send the offer to the kafka topic
-	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: s.offerTopic,
-		Key:   sarama.StringEncoder("created"),
-		Value: sarama.StringEncoder(fmt.Sprint(*createdOffer.OfferId)),
+	// Create the counter-offer, update the original and queue both events in one transaction
+	var counterOffer *dal.Offer
+	err = s.db.WithTx(func(tx dal.TxStore) error {
+		// Lock the original offer so it can't be accepted, countered or expired at the same time
+		parent, err := tx.GetOfferForUpdate(id)
+		if err != nil {
+			return err
+		}
+
+		dalOffer, err := newCounterOffer(actorId, parent, counter.OffererGameIds, counter.RecipientGameIds, now)
+		if err != nil {
+			return err
+		}
+		dalOffer.ExpiresAt = &expiresAt
+
+		// Refuse games that are held by another pending offer. The offer being countered is about to
+		// give up its hold, so its games are fair game.
+		if s.exclusiveHold {
+			err = checkHolds(tx, dalOffer, parent.OfferId)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Verify the counter-offer before creating it, so an invalid one leaves the original pending
+		err = validateOffer(tx, dalOffer)
+		if err != nil {
+			return err
+		}
+
+		// Call the db methods to create the counter-offer and update the original
+		counterOffer, err = tx.CreateOffer(dalOffer)
+		if err != nil {
+			return err
+		}
+		err = recordOfferEvent(tx, *counterOffer.OfferId, nil, dal.Pending, &actorId, fmt.Sprintf("counters offer %v", id))
+		if err != nil {
+			return err
+		}
+		err = transitionOffer(tx, parent, dal.Countered, &actorId, fmt.Sprintf("countered by offer %v", *counterOffer.OfferId))
+		if err != nil {
+			return err
+		}
+
+		event, err := newOfferEvent(tx, events.Countered, &actorId, parent)
+		if err != nil {
+			return err
+		}
+		err = enqueueEvent(tx, s.offerTopic, event)
+		if err != nil {
+			return err
+		}
+		event, err = newOfferEvent(tx, events.Created, &actorId, counterOffer)
+		if err != nil {
+			return err
+		}
+		return enqueueEvent(tx, s.offerTopic, event)
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	// Convert the dal model to the api model
+	apiOffer := s.convertOffer(counterOffer)
+
+	return &apiOffer, nil
+}
+
+// Returns the negotiation the offer is part of, from the first offer to the latest counter-offer.
+func (s *Service) GetOfferHistory(id api.OfferId) (*api.OfferHistoryResponse, error) {
+	// Call the db method to get the chain of offers
+	dalOffers, err := s.db.GetOfferHistory(id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Convert the dal model to the api model
-	apiOffer := api.OfferResponse{
-		OfferId:         *createdOffer.OfferId,
-		OffererUserId:   "/users/" + fmt.Sprint(*createdOffer.OffererUserId),
-		OffererGameId:   "/games/" + fmt.Sprint(*createdOffer.OffererGameId),
-		RecipientUserId: "/users/" + fmt.Sprint(*createdOffer.RecipientUserId),
-		RecipientGameId: "/games/" + fmt.Sprint(*createdOffer.RecipientGameId),
-		Status:          api.OfferStatusEnum(createdOffer.Status),
+	history := api.OfferHistoryResponse{Data: []api.OfferResponse{}}
+	for _, offer := range dalOffers {
+		history.Data = append(history.Data, s.convertOffer(&offer))
 	}
 
-	return &apiOffer, nil
+	return &history, nil
 }
 
-func (s *Service) UpdateOffer(id api.OfferId, offer *api.PatchOffer) error {
+func (s *Service) UpdateOffer(actorId api.UserId, id api.OfferId, offer *api.PatchOffer) error {
 	// Convert the api model to the dal model
 	dalOffer := dal.Offer{
 		Status: s.convertStatus(offer),
 	}
 
-	// Verify the offer
-	err := s.validateOffer(int(id))
+	// Countering an offer takes the games of the counter-offer, so it has its own operation, and
+	// offers only expire on their own
+	switch dalOffer.Status {
+	case dal.Countered:
+		return fmt.Errorf("%w: offers are countered with POST /offers/{offerId}/counter", api.ErrBadRequest)
+	case dal.Expired:
+		return fmt.Errorf("%w: offers can't be expired by hand", api.ErrBadRequest)
+	}
+
+	// Apply the change in one transaction so the status change and the ownership swap (if accepted)
+	// commit or roll back together
+	var invalid error
+	err := s.db.WithTx(func(tx dal.TxStore) error {
+		// Lock the offer so concurrent updates see the status this one leaves behind
+		current, err := tx.GetOfferForUpdate(id)
+		if err != nil {
+			return err
+		}
+
+		// Check that the actor is allowed to make this change
+		err = authorizeOfferUpdate(actorId, current, dalOffer.Status)
+		if err != nil {
+			return err
+		}
+
+		// Check that the offer can move to the new status and hasn't expired without being swept yet
+		err = checkTransition(current.Status, dalOffer.Status)
+		if err != nil {
+			return err
+		}
+		err = checkExpiry(current, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		// Update the game owners if the offer was accepted, rejecting the offer instead if either
+		// user no longer owns their game, then cancel the other offers for the games that changed hands
+		if dalOffer.Status == dal.Accepted {
+			err = executeOffer(tx, current)
+			if errors.Is(err, api.ErrConflict) {
+				invalid = err
+				err = transitionOffer(tx, current, dal.Rejected, &actorId, err.Error())
+				if err != nil {
+					return err
+				}
+				event, err := newOfferEvent(tx, events.Rejected, &actorId, current)
+				if err != nil {
+					return err
+				}
+				return enqueueEvent(tx, s.offerTopic, event)
+			}
+			if err != nil {
+				return err
+			}
+
+			err = cancelConflictingOffers(tx, s.offerTopic, actorId, current)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Call the db method to update the offer
+		err = transitionOffer(tx, current, dalOffer.Status, &actorId, "")
+		if err != nil {
+			return err
+		}
+
+		event, err := newOfferEvent(tx, string(dalOffer.Status), &actorId, current)
+		if err != nil {
+			return err
+		}
+		return enqueueEvent(tx, s.offerTopic, event)
+	})
 	if err != nil {
 		return err
 	}
 
-	// Call the db method to update the offer
-	err = s.db.UpdateOffer(id, &dalOffer)
+	return invalid
+}
+
+// Returns the offer's audit trail: every change to its status, oldest first.
+func (s *Service) GetOfferEvents(id api.OfferId) (*api.OfferEventsResponse, error) {
+	// Check the offer exists, since one without events doesn't
+	_, err := s.db.GetOffer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the db method to get the events
+	dalEvents, err := s.db.GetOfferEvents(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Convert the dal model to the api model
+	apiEvents := api.OfferEventsResponse{Data: []api.OfferEvent{}}
+	for _, event := range dalEvents {
+		apiEvent := api.OfferEvent{
+			To:         api.OfferStatusEnum(event.ToStatus),
+			OccurredAt: *event.CreatedAt,
+			Reason:     event.Reason,
+		}
+		if event.FromStatus != nil {
+			from := api.OfferStatusEnum(*event.FromStatus)
+			apiEvent.From = &from
+		}
+		if event.ActorUserId != nil {
+			actor := "/users/" + fmt.Sprint(*event.ActorUserId)
+			apiEvent.ActorUserId = &actor
+		}
+		apiEvents.Data = append(apiEvents.Data, apiEvent)
 	}
 
-	// Update the game owners if the offer was accepted
-	if dalOffer.Status == dal.Accepted {
-		err = s.executeOffer(int(id))
+	return &apiEvents, nil
+}
+
+func (s *Service) DeleteOffer(actorId api.UserId, id api.OfferId) error {
+	// Offers aren't deleted, so their audit trail is kept; deleting a pending offer cancels it
+	return s.db.WithTx(func(tx dal.TxStore) error {
+		offer, err := tx.GetOfferForUpdate(id)
 		if err != nil {
 			return err
 		}
-	}
 
-	// Send the offer to the kafka topic
-	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: s.offerTopic,
-		Key:   sarama.StringEncoder(dalOffer.Status),
-		Value: sarama.StringEncoder(fmt.Sprint(id)),
+		// Only the offerer may delete the offer
+		if *offer.OffererUserId != actorId {
+			return api.ErrForbidden
+		}
+
+		// Check that the offer is still pending and hasn't expired without being swept yet
+		err = checkTransition(offer.Status, dal.Cancelled)
+		if err != nil {
+			return err
+		}
+		err = checkExpiry(offer, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		err = transitionOffer(tx, offer, dal.Cancelled, &actorId, "offer deleted by its offerer")
+		if err != nil {
+			return err
+		}
+
+		event, err := newOfferEvent(tx, events.Cancelled, &actorId, offer)
+		if err != nil {
+			return err
+		}
+		return enqueueEvent(tx, s.offerTopic, event)
 	})
+}
+
+func (s *Service) authorizeGameOwner(actorId int, gameId int) error {
+	game, err := s.db.GetGame(gameId)
 	if err != nil {
 		return err
 	}
-
+	if *game.UserId != actorId {
+		return api.ErrForbidden
+	}
 	return nil
 }
 
-func (s *Service) DeleteOffer(id api.OfferId) error {
-	// Call the db method to delete the offer
-	return s.db.DeleteOffer(id)
+// Only the offerer may cancel an offer and only the recipient may accept, reject or counter it.
+func authorizeOfferUpdate(actorId int, offer *dal.Offer, status dal.StatusCondition) error {
+	switch status {
+	case dal.Cancelled:
+		if *offer.OffererUserId != actorId {
+			return api.ErrForbidden
+		}
+	case dal.Accepted, dal.Rejected, dal.Countered:
+		if *offer.RecipientUserId != actorId {
+			return api.ErrForbidden
+		}
+	default:
+		if *offer.OffererUserId != actorId && *offer.RecipientUserId != actorId {
+			return api.ErrForbidden
+		}
+	}
+	return nil
 }
 
-// ------------------- Helpers -------------------//
-
-func (s *Service) validateOffer(offerId int) error {
-	// Retrieve the offer
-	offer, err := s.db.GetOffer(offerId)
+// Builds the counter-offer the actor makes in response to the offer, after checking that they're its
+// recipient and that it can still be countered at the given time. The counter-offer goes the other
+// way: its offerer is the original recipient.
+func newCounterOffer(actorId int, parent *dal.Offer, offererGameIds []int, recipientGameIds []int, now time.Time) (*dal.Offer, error) {
+	err := authorizeOfferUpdate(actorId, parent, dal.Countered)
 	if err != nil {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return err
+		return nil, err
+	}
+	err = checkTransition(parent.Status, dal.Countered)
+	if err != nil {
+		return nil, err
 	}
+	err = checkExpiry(parent, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dal.Offer{
+		OffererUserId:    parent.RecipientUserId,
+		RecipientUserId:  parent.OffererUserId,
+		OffererGameIds:   offererGameIds,
+		RecipientGameIds: recipientGameIds,
+		Status:           dal.Pending,
+		ParentOfferId:    parent.OfferId,
+	}, nil
+}
 
+// Checks that the offer is between two different users who each give up at least one game, that no
+// game is listed twice and that each user owns every game on their side. Failures wrap
+// api.ErrConflict.
+func validateOffer(tx dal.TxStore, offer *dal.Offer) error {
 	// Check if the offerer and recipient are different
 	if *offer.OffererUserId == *offer.RecipientUserId {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return fmt.Errorf("offerer and recipient cannot be the same user")
+		return fmt.Errorf("%w: offerer and recipient cannot be the same user", api.ErrConflict)
 	}
 
-	// Check if the offerer and recipient games are different
-	if *offer.OffererGameId == *offer.RecipientGameId {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return fmt.Errorf("offerer and recipient games cannot be the same game")
+	// Check that both sides give something up
+	if len(offer.OffererGameIds) == 0 || len(offer.RecipientGameIds) == 0 {
+		return fmt.Errorf("%w: both sides of an offer need at least one game", api.ErrConflict)
 	}
 
-	// Check if the offerer and recipient games are owned by the correct users
-	offererGame, err := s.db.GetGame(*offer.OffererGameId)
-	if err != nil {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return err
+	// Check that no game is listed twice, on the same side or on both
+	seen := map[int]bool{}
+	for _, gameId := range append(slices.Clone(offer.OffererGameIds), offer.RecipientGameIds...) {
+		if seen[gameId] {
+			return fmt.Errorf("%w: game %v is listed more than once", api.ErrConflict, gameId)
+		}
+		seen[gameId] = true
 	}
-	if *offererGame.UserId != *offer.OffererUserId {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return fmt.Errorf("offerer does not own the offerer game")
+
+	// Check if every game is owned by the user giving it up
+	for _, gameId := range offer.OffererGameIds {
+		game, err := tx.GetGame(gameId)
+		if err != nil {
+			return err
+		}
+		if *game.UserId != *offer.OffererUserId {
+			return fmt.Errorf("%w: offerer does not own game %v", api.ErrConflict, gameId)
+		}
+	}
+	for _, gameId := range offer.RecipientGameIds {
+		game, err := tx.GetGame(gameId)
+		if err != nil {
+			return err
+		}
+		if *game.UserId != *offer.RecipientUserId {
+			return fmt.Errorf("%w: recipient does not own game %v", api.ErrConflict, gameId)
+		}
 	}
 
-	recipientGame, err := s.db.GetGame(*offer.RecipientGameId)
+	return nil
+}
+
+// Transfers every game in the offer to the other user. All of the games are locked first and
+// ownership is checked again, since any of them may have been traded away since the offer was made;
+// ownership failures wrap api.ErrConflict.
+func executeOffer(tx dal.TxStore, offer *dal.Offer) error {
+	games, err := lockGames(tx, offer)
 	if err != nil {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
 		return err
 	}
-	if *recipientGame.UserId != *offer.RecipientUserId {
-		s.db.UpdateOffer(offerId, &dal.Offer{Status: dal.Rejected})
-		return fmt.Errorf("recipient does not own the recipient game")
+
+	// Verify the users still own the games
+	for _, gameId := range offer.OffererGameIds {
+		if *games[gameId].UserId != *offer.OffererUserId {
+			return fmt.Errorf("%w: offerer no longer owns game %v", api.ErrConflict, gameId)
+		}
+	}
+	for _, gameId := range offer.RecipientGameIds {
+		if *games[gameId].UserId != *offer.RecipientUserId {
+			return fmt.Errorf("%w: recipient no longer owns game %v", api.ErrConflict, gameId)
+		}
+	}
+
+	// Change the Offerer's games to the Recipient's user
+	for _, gameId := range offer.OffererGameIds {
+		err := tx.ChangeGameUserId(gameId, *offer.RecipientUserId)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Change the Recipient's games to the Offerer's user
+	for _, gameId := range offer.RecipientGameIds {
+		err := tx.ChangeGameUserId(gameId, *offer.OffererUserId)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (s *Service) executeOffer(offerId int) error {
-	// Get the offer
-	offer, err := s.db.GetOffer(offerId)
-	if err != nil {
-		return err
+// Locks every game in the offer until the transaction ends and returns them by gameId. The games are
+// locked in gameId order so concurrent transactions over the same games can't deadlock.
+func lockGames(tx dal.TxStore, offer *dal.Offer) (map[int]*dal.Game, error) {
+	gameIds := append(slices.Clone(offer.OffererGameIds), offer.RecipientGameIds...)
+	slices.Sort(gameIds)
+	games := map[int]*dal.Game{}
+	for _, gameId := range gameIds {
+		game, err := tx.GetGameForUpdate(gameId)
+		if err != nil {
+			return nil, err
+		}
+		games[gameId] = game
 	}
+	return games, nil
+}
 
-	// Verify offer status
-	if offer.Status != dal.Accepted {
-		return fmt.Errorf("offer status is not accepted, cannot execute trade")
+// Checks that none of the games in the offer are held by a pending offer other than the excluded
+// one, returning an error wrapping api.ErrConflict if any are. The games are locked first, so two
+// offers for the same game can't both pass the check before either is created.
+func checkHolds(tx dal.TxStore, offer *dal.Offer, excludeOfferId *int) error {
+	_, err := lockGames(tx, offer)
+	if err != nil {
+		return err
 	}
 
-	// Change Offerer's game to Recipient's user
-	err = s.db.ChangeGameUserId(*offer.OffererGameId, *offer.RecipientUserId)
+	held, err := tx.GetPendingOffersWithGames(append(slices.Clone(offer.OffererGameIds), offer.RecipientGameIds...))
 	if err != nil {
 		return err
 	}
+	for _, other := range held {
+		if excludeOfferId != nil && *other.OfferId == *excludeOfferId {
+			continue
+		}
+		return fmt.Errorf("%w: offer %v already holds one of the games", api.ErrConflict, *other.OfferId)
+	}
+	return nil
+}
 
-	// Change Recipient's game to Offerer's user
-	err = s.db.ChangeGameUserId(*offer.RecipientGameId, *offer.OffererUserId)
+// Cancels the other pending offers for any of the games in an accepted offer, since their games have
+// changed hands, and queues an event for each. Offers being changed by another transaction are
+// skipped; if they're accepted later, executeOffer finds the games have moved and rejects them.
+func cancelConflictingOffers(tx dal.TxStore, topic string, actorId int, accepted *dal.Offer) error {
+	conflicting, err := tx.ClaimPendingOffersWithGames(append(slices.Clone(accepted.OffererGameIds), accepted.RecipientGameIds...))
 	if err != nil {
 		return err
 	}
 
+	for _, offer := range conflicting {
+		if *offer.OfferId == *accepted.OfferId {
+			continue
+		}
+		err := transitionOffer(tx, &offer, dal.Cancelled, &actorId, fmt.Sprintf("offer %v traded one of its games", *accepted.OfferId))
+		if err != nil {
+			return err
+		}
+
+		event, err := newOfferEvent(tx, events.Cancelled, &actorId, &offer)
+		if err != nil {
+			return err
+		}
+		err = enqueueEvent(tx, topic, event)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Converts gameIds to hateoas links.
+func gameLinks(gameIds []int) []string {
+	links := []string{}
+	for _, gameId := range gameIds {
+		links = append(links, "/games/"+fmt.Sprint(gameId))
+	}
+	return links
+}
+
+// The preferences of users who have never saved their own: every channel, nothing muted, sent immediately
+func defaultPreferences() *api.NotificationPreferences {
+	return &api.NotificationPreferences{
+		Channels:    []api.NotificationChannelEnum{api.Smtp, api.Webhook, api.File},
+		MutedEvents: []api.NotificationEventEnum{},
+		Delivery:    api.Immediate,
+	}
+}
+
 func (s *Service) convertCondition(condition *api.GameConditionEnum) *dal.GameCondition {
 	if condition == nil {
 		return nil
@@ -521,3 +1106,20 @@ func (s *Service) convertStatus(status *api.OfferStatusEnum) dal.StatusCondition
 	converted := dal.StatusCondition(*status)
 	return converted
 }
+
+func (s *Service) convertOffer(offer *dal.Offer) api.OfferResponse {
+	converted := api.OfferResponse{
+		OfferId:          *offer.OfferId,
+		OffererUserId:    "/users/" + fmt.Sprint(*offer.OffererUserId),
+		RecipientUserId:  "/users/" + fmt.Sprint(*offer.RecipientUserId),
+		OffererGameIds:   gameLinks(offer.OffererGameIds),
+		RecipientGameIds: gameLinks(offer.RecipientGameIds),
+		Status:           api.OfferStatusEnum(offer.Status),
+		ExpiresAt:        *offer.ExpiresAt,
+	}
+	if offer.ParentOfferId != nil {
+		parent := "/offers/" + fmt.Sprint(*offer.ParentOfferId)
+		converted.ParentOfferId = &parent
+	}
+	return converted
+}
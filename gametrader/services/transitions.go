@@ -0,0 +1,65 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+// Legal offer status transitions. Offers start out pending and can be accepted, rejected, cancelled,
+// countered or expired once; every status other than pending is terminal.
+var offerTransitions = map[dal.StatusCondition][]dal.StatusCondition{
+	dal.Pending: {dal.Accepted, dal.Rejected, dal.Cancelled, dal.Countered, dal.Expired},
+}
+
+// Returns an error wrapping api.ErrConflict if an offer can't move from one status to the other.
+func checkTransition(from dal.StatusCondition, to dal.StatusCondition) error {
+	for _, allowed := range offerTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: offer cannot change from %v to %v", api.ErrConflict, from, to)
+}
+
+// Returns an error wrapping api.ErrConflict if the offer is still pending at the given time but past
+// its expiry, because the sweeper hasn't got to it yet.
+func checkExpiry(offer *dal.Offer, now time.Time) error {
+	if offer.Status == dal.Pending && offer.ExpiresAt != nil && !now.Before(*offer.ExpiresAt) {
+		return fmt.Errorf("%w: offer expired at %v", api.ErrConflict, offer.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Moves the offer to a new status and records the change in its audit trail, after checking the
+// transition is legal. Updates the offer's Status to match.
+func transitionOffer(tx dal.TxStore, offer *dal.Offer, to dal.StatusCondition, actorId *int, reason string) error {
+	from := offer.Status
+	err := checkTransition(from, to)
+	if err != nil {
+		return err
+	}
+	err = tx.UpdateOffer(*offer.OfferId, &dal.Offer{Status: to})
+	if err != nil {
+		return err
+	}
+	offer.Status = to
+	return recordOfferEvent(tx, *offer.OfferId, &from, to, actorId, reason)
+}
+
+// Records a change to an offer's status in its audit trail. From is nil for the offer's creation, the
+// actor is nil for changes nobody asked for, like expiry, and an empty reason isn't stored.
+func recordOfferEvent(tx dal.TxStore, offerId int, from *dal.StatusCondition, to dal.StatusCondition, actorId *int, reason string) error {
+	event := dal.OfferEvent{
+		OfferId:     offerId,
+		FromStatus:  from,
+		ToStatus:    to,
+		ActorUserId: actorId,
+	}
+	if reason != "" {
+		event.Reason = &reason
+	}
+	return tx.CreateOfferEvent(&event)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/robertjshirts/gobuster/api"
+	"github.com/robertjshirts/gobuster/dal"
+)
+
+func TestCheckTransition(t *testing.T) {
+	// The only legal transitions. Every other pair of statuses, including any status added later,
+	// must be rejected.
+	legal := map[dal.StatusCondition][]dal.StatusCondition{
+		dal.Pending: {dal.Accepted, dal.Rejected, dal.Cancelled, dal.Countered, dal.Expired},
+	}
+
+	for _, from := range dal.StatusConditions {
+		for _, to := range dal.StatusConditions {
+			t.Run(string(from)+"->"+string(to), func(t *testing.T) {
+				err := checkTransition(from, to)
+				if slices.Contains(legal[from], to) {
+					if err != nil {
+						t.Fatalf("expected transition to be legal, got %v", err)
+					}
+					return
+				}
+				if !errors.Is(err, api.ErrConflict) {
+					t.Fatalf("expected api.ErrConflict, got %v", err)
+				}
+			})
+		}
+	}
+
+	// The transition table doesn't mention statuses the loop above doesn't know about
+	for from, tos := range offerTransitions {
+		for _, status := range append([]dal.StatusCondition{from}, tos...) {
+			if !slices.Contains(dal.StatusConditions, status) {
+				t.Errorf("status %v is missing from dal.StatusConditions", status)
+			}
+		}
+	}
+}
+
+func TestTransitionOffer(t *testing.T) {
+	tx := newFakeTx(map[int]int{1: 1, 4: 2})
+	offer, err := tx.CreateOffer(bundle(1, []int{1}, 2, []int{4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actorId := 2
+	err = transitionOffer(tx, offer, dal.Rejected, &actorId, "not interested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer.Status != dal.Rejected || tx.offers[*offer.OfferId].Status != dal.Rejected {
+		t.Errorf("expected the offer to be rejected, got %v", tx.offers[*offer.OfferId].Status)
+	}
+	if len(tx.offerEvents) != 1 {
+		t.Fatalf("expected one audit event, got %v", len(tx.offerEvents))
+	}
+	event := tx.offerEvents[0]
+	if *event.FromStatus != dal.Pending || event.ToStatus != dal.Rejected || *event.ActorUserId != actorId || *event.Reason != "not interested" {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+
+	// Illegal transitions change and record nothing
+	err = transitionOffer(tx, offer, dal.Accepted, &actorId, "")
+	if !errors.Is(err, api.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if tx.offers[*offer.OfferId].Status != dal.Rejected || len(tx.offerEvents) != 1 {
+		t.Errorf("expected an illegal transition to leave the offer alone, got %v with %v events", tx.offers[*offer.OfferId].Status, len(tx.offerEvents))
+	}
+}
@@ -12,6 +12,8 @@ func defaultSaramaConfig() map[string]string {
 		"brokers": "kafka:9092",
 		"offerTopic": "offer",
 		"userTopic": "user",
+		"partitions": "1",
+		"replicationFactor": "1",
 	}
 }
 
@@ -86,4 +88,79 @@ func ReadDatabaseConfig(configFile string) map[string]string {
 	}
 
 	return m
-}
\ No newline at end of file
+}
+
+func defaultAuthConfig() map[string]string {
+	return map[string]string{
+		"tokenTTL": "1h",
+	}
+}
+
+func ReadAuthConfig(configFile string) map[string]string {
+	m := defaultAuthConfig()
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening auth config file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") && len(line) > 0 {
+			before, after, found := strings.Cut(line, "=")
+			if found {
+				parameter := strings.TrimSpace(before)
+				value := strings.TrimSpace(after)
+				m[parameter] = value
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Failed to read file: %s", err)
+		os.Exit(1)
+	}
+
+	return m
+}
+
+func defaultOffersConfig() map[string]string {
+	return map[string]string{
+		"expiry": "168h",
+		"exclusiveHold": "false",
+	}
+}
+
+func ReadOffersConfig(configFile string) map[string]string {
+	m := defaultOffersConfig()
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening offers config file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") && len(line) > 0 {
+			before, after, found := strings.Cut(line, "=")
+			if found {
+				parameter := strings.TrimSpace(before)
+				value := strings.TrimSpace(after)
+				m[parameter] = value
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Failed to read file: %s", err)
+		os.Exit(1)
+	}
+
+	return m
+}
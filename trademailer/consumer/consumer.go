@@ -2,10 +2,11 @@ package consumer
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"net/smtp"
-	"strconv"
+	"slices"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -13,34 +14,62 @@ import (
 	"github.com/robertjshirts/trademailer/dal"
 )
 
-var smtpServer = "smtp.gmail.com"
-var smtpPort = "587"
-
 type Datastore interface {
 	GetOfferDetails(offerId int) (*dal.Offer, error)
 	GetUserDetails(userId int) (*dal.User, error)
+	GetGameDetails(gameId int) (*dal.Game, error)
+	GetPreferences(userId int) (*dal.Preferences, error)
+
+	ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error)
+	CompleteDelivery(eventId string, userId int, channel string) error
+	ReleaseDelivery(eventId string, userId int, channel string) error
 }
 
 type KafkaConsumer struct {
 	db            Datastore
+	routes        *Routes
+	digests       *Digester
 	ConsumerGroup sarama.ConsumerGroup
-	Topics        []string
+	registry      *Registry
+
+	// Failed deliveries are published to the retry topic for their delay, and to the dead-letter
+	// topic once they're out of retries
+	producer        sarama.SyncProducer
+	retryTopic      string
+	deadLetterTopic string
+
+	// The number of workers handling each claimed partition
+	workers int
 }
 
-func Init(db Datastore, brokers []string, group string, topics []string, server string, port string) (*KafkaConsumer, error) {
-	smtpServer = server
-	smtpPort = port
+func Init(db Datastore, brokers []string, group string, workers int, registry *Registry, retryTopic string, deadLetterTopic string, routes *Routes, digests *Digester) (*KafkaConsumer, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("need at least one worker per partition, not %v", workers)
+	}
+
+	if registry == nil || len(registry.Topics()) == 0 {
+		return nil, fmt.Errorf("no topic handlers registered")
+	}
 
 	config := sarama.NewConfig()
 	config.Version = sarama.V3_3_0_0
 	config.Consumer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
 
 	var consumerGroup sarama.ConsumerGroup
+	var producer sarama.SyncProducer
 	var err error
 
 	connected := false
 	for attempts := 0; attempts < 5; attempts++ {
 		consumerGroup, err = sarama.NewConsumerGroup(brokers, group, config)
+		if err == nil {
+			producer, err = sarama.NewSyncProducer(brokers, config)
+			if err != nil {
+				consumerGroup.Close()
+			}
+		}
 		if err != nil {
 			fmt.Println("Failed to connect to the Kafka cluster. Retrying in 5 seconds...")
 			time.Sleep(5 * time.Second)
@@ -54,200 +83,373 @@ func Init(db Datastore, brokers []string, group string, topics []string, server
 		return nil, fmt.Errorf("failed to connect to the Kafka cluster after 5 attempts")
 	}
 
-	fmt.Printf("Connected to the Kafka cluster at %v \n with topics %v\n", brokers, topics)
+	fmt.Printf("Connected to the Kafka cluster at %v \n with topics %v\n", brokers, registry.Topics())
 
-	fmt.Println("Waiting 5 seconds for producers to initialize topics...")
+	fmt.Println("Waiting 5 seconds for gametrader to create topics...")
 	time.Sleep(6 * time.Second)
 
 	if db == nil {
 		return nil, fmt.Errorf("no datastore provided")
 	}
 
+	if routes == nil {
+		return nil, fmt.Errorf("no notification routes provided")
+	}
+
+	if digests == nil {
+		return nil, fmt.Errorf("no digester provided")
+	}
+
 	return &KafkaConsumer{
-		db:            db,
-		ConsumerGroup: consumerGroup,
-		Topics:        topics,
+		db:              db,
+		routes:          routes,
+		digests:         digests,
+		ConsumerGroup:   consumerGroup,
+		registry:        registry,
+		producer:        producer,
+		retryTopic:      retryTopic,
+		deadLetterTopic: deadLetterTopic,
+		workers:         workers,
 	}, nil
 }
 
+// Creates the topics that don't exist yet. Gametrader creates the topics it publishes events to, and
+// trademailer creates the retry and dead-letter topics it owns.
+func CreateTopics(brokers []string, topics []string, partitions int32, replicationFactor int16) error {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_3_0_0
+
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		if _, ok := existing[topic]; ok {
+			continue
+		}
+		err := admin.CreateTopic(topic, &sarama.TopicDetail{
+			NumPartitions:     partitions,
+			ReplicationFactor: replicationFactor,
+		}, false)
+		// Another replica may have created it since the topics were listed
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("creating topic %v: %w", topic, err)
+		}
+		fmt.Printf("Created topic %v\n", topic)
+	}
+	return nil
+}
+
 func (ks *KafkaConsumer) Close() error {
-	return ks.ConsumerGroup.Close()
+	err := ks.ConsumerGroup.Close()
+	if producerErr := ks.producer.Close(); err == nil {
+		err = producerErr
+	}
+	return err
 }
 
-func (kc *KafkaConsumer) Consume(ctx context.Context) {
+// Consumes until the context is cancelled or the consumer group is closed, rejoining the group after
+// every rebalance. Returns nil on a clean shutdown. Sends still in progress when the context is
+// cancelled are cut off and their messages left unmarked to be consumed again, and marked offsets are
+// committed.
+func (kc *KafkaConsumer) Consume(ctx context.Context) error {
+	topics := append(kc.registry.Topics(), retryTopics(kc.retryTopic)...)
 	for {
 		handler := &consumerGroupHandler{
-			db: kc.db,
+			db:              kc.db,
+			registry:        kc.registry,
+			routes:          kc.routes,
+			digests:         kc.digests,
+			producer:        kc.producer,
+			retryTopic:      kc.retryTopic,
+			deadLetterTopic: kc.deadLetterTopic,
+			workers:         kc.workers,
+			pauser:          kc.ConsumerGroup,
+		}
+		err := kc.ConsumerGroup.Consume(ctx, topics, handler)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return nil
 		}
-		err := kc.ConsumerGroup.Consume(ctx, kc.Topics, handler)
 		if err != nil {
-			log.Panicf("Error consuming: %v", err)
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
 		}
 	}
 }
 
+// Errors from the consumer group that don't end consumption, such as failed offset commits. Must be
+// read, or the consumer group blocks once the channel's buffer is full. Closed by Close.
+func (kc *KafkaConsumer) Errors() <-chan error {
+	return kc.ConsumerGroup.Errors()
+}
+
 type consumerGroupHandler struct {
-	db Datastore
+	db              Datastore
+	registry        *Registry
+	routes          *Routes
+	digests         *Digester
+	producer        sarama.SyncProducer
+	retryTopic      string
+	deadLetterTopic string
+	workers         int
+	// Pauses partitions whose next retry isn't due yet. Nil if partitions are never paused.
+	pauser pauser
+}
+
+// Pauses and resumes fetching partitions. Implemented by sarama.ConsumerGroup.
+type pauser interface {
+	Pause(partitions map[string][]int32)
+	Resume(partitions map[string][]int32)
 }
 
-func (consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
-func (consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+// Runs at the start of each session, once partitions have been assigned after joining or
+// rebalancing the group.
+func (consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	fmt.Printf("Consumer group session %v started with partitions %v\n", session.GenerationID(), session.Claims())
+	return nil
+}
+
+// Runs at the end of each session, after every ConsumeClaim has returned and before partitions are
+// handed back, so the offsets marked in the session are committed before another consumer takes over.
+func (consumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	fmt.Printf("Consumer group session %v ended\n", session.GenerationID())
+	return nil
+}
+
+// Handles the claim's messages on a pool of workers until the session ends. Messages are only marked
+// once every message before them in the partition has been handled, and the workers are waited for
+// before returning so nothing is marked after the session ends. A retry message that isn't due yet
+// is held back with its partition paused until it is. Every delivery in a retry tier waited the same
+// delay, so they come due in the order they were published and nothing behind it could be due first.
 func (h consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		topic := message.Topic
-		key := string(message.Key)
-		value := string(message.Value)
-		fmt.Printf("Message claimed: Topic: %s | Key: %s | Value: %s\n", topic, key, value)
-
-		switch topic {
-		case "offer":
-			offerId, err := strconv.Atoi(value)
-			if err != nil {
-				fmt.Printf("Error converting offer id to int: %v\n", err)
-				break
+	pool := newClaimPool(h.handle, session, h.workers)
+	partition := map[string][]int32{claim.Topic(): {claim.Partition()}}
+	retrying := slices.Contains(retryTopics(h.retryTopic), claim.Topic())
+
+	// Set while a retry message is waiting to come due, when nothing more is read from the claim
+	var waiting *sarama.ConsumerMessage
+	var due <-chan time.Time
+	messages := claim.Messages()
+	for {
+		select {
+		case <-session.Context().Done():
+			if waiting != nil {
+				h.resume(partition)
 			}
-
-			offer, err := h.db.GetOfferDetails(offerId)
-			if err != nil {
-				fmt.Printf("Error getting offer details: %v\n", err)
-				break
+			pool.stop()
+			return nil
+		case <-due:
+			h.resume(partition)
+			pool.dispatch(waiting)
+			waiting, due, messages = nil, nil, claim.Messages()
+		case message, ok := <-messages:
+			if !ok {
+				pool.stop()
+				return nil
 			}
-
-			offerer, err := h.db.GetUserDetails(offer.OffererUserId)
-			if err != nil {
-				fmt.Printf("Error getting offerer details: %v\n", err)
-				break
+			if retrying {
+				if wait := time.Until(retryAt(message)); wait > 0 {
+					h.pause(partition)
+					waiting, due, messages = message, time.After(wait), nil
+					continue
+				}
 			}
+			pool.dispatch(message)
+		}
+	}
+}
 
-			recipient, err := h.db.GetUserDetails(offer.RecipientUserId)
-			if err != nil {
-				fmt.Printf("Error getting recipient details: %v\n", err)
-				break
-			}
+// Stops fetching messages for the partitions until they're resumed
+func (h consumerGroupHandler) pause(partitions map[string][]int32) {
+	if h.pauser != nil {
+		h.pauser.Pause(partitions)
+	}
+}
 
-			sendOffererEmail(offerer, recipient, key)
-			sendRecipientEmail(recipient, offerer, key)
-		case "user":
-			userId, err := strconv.Atoi(value)
-			if err != nil {
-				fmt.Printf("Error converting user id to int: %v\n", err)
-				break
-			}
+func (h consumerGroupHandler) resume(partitions map[string][]int32) {
+	if h.pauser != nil {
+		h.pauser.Resume(partitions)
+	}
+}
 
-			user, err := h.db.GetUserDetails(userId)
-			if err != nil {
-				fmt.Printf("Error getting user details: %v\n", err)
-				break
-			}
+// The key of the messages older versions of gametrader primed topics with
+const primingKey = "init"
 
-			sendUserEmail(user, key)
-		}
+// Handles one message. Failed deliveries have already been handed to the retry or dead-letter topic
+// when this returns, so an error means ctx was done before the message could be handled and it has to
+// be consumed again.
+func (h consumerGroupHandler) handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	topic := message.Topic
+	// The value holds both users' names and emails, so only the message's position and ids are logged
+	fmt.Printf("Message claimed: Topic: %s | Partition: %d | Offset: %d | Key: %s | Event: %s\n",
+		topic, message.Partition, message.Offset, string(message.Key), messageEventId(message.Value))
 
-		session.MarkMessage(message, "")
+	if slices.Contains(retryTopics(h.retryTopic), topic) {
+		return h.handleRetry(ctx, message)
 	}
-	return nil
+
+	// Older versions of gametrader primed each topic with an "init" message on startup. They aren't
+	// events, so they're skipped rather than dead-lettered.
+	if string(message.Key) == primingKey {
+		return nil
+	}
+	return h.handleEvent(ctx, message, 0)
+}
+
+// Returns the id of the event a message holds, or "" for legacy events, retries and messages that
+// can't be decoded.
+func messageEventId(value []byte) string {
+	var event struct {
+		EventId string `json:"eventId"`
+	}
+	json.Unmarshal(value, &event)
+	return event.EventId
 }
 
-func sendOffererEmail(offerer *dal.User, recipient *dal.User, event string) {
-
-	to := []string{recipient.Email}
-	auth := smtp.PlainAuth("", offerer.Email, offerer.Password, smtpServer)
-	var msg = []byte{}
-
-	switch event {
-	case "created":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Successfully Created\r\n"+
-			"\r\n"+
-			"Congratulations, %s! Your offer to %s was successfully created!",
-			offerer.Email, offerer.Name, recipient.Name))
-	case "accepted":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Accepted\r\n"+
-			"\r\n"+
-			"Congratulations, %s! Your offer to %s was accepted!",
-			offerer.Email, offerer.Name, recipient.Name))
-	case "rejected":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Rejected\r\n"+
-			"\r\n"+
-			"Sorry, %s. Your offer to %s was rejected.",
-			offerer.Email, offerer.Name, recipient.Name))
-	case "cancelled":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Cancelled\r\n"+
-			"\r\n"+
-			"Hey there, %s. Your offer to %s was cancelled.",
-			offerer.Email, offerer.Name, recipient.Name))
-	}
-
-	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, offerer.Email, to, msg)
+// Notifies the users an event is about, using the handler registered for the message's topic.
+// Retries counts how many times the message has already been retried from the retry topic.
+func (h consumerGroupHandler) handleEvent(ctx context.Context, message *sarama.ConsumerMessage, retries int) error {
+	handler, ok := h.registry.Handler(message.Topic)
+	if !ok {
+		return h.fail(ctx, newDelivery(message, retries), fmt.Errorf("no handler registered for topic %v", message.Topic), true)
+	}
+
+	event, err := handler.Decode(message.Key, message.Value)
 	if err != nil {
-		fmt.Printf("Error sending email: %v\n", err)
-	}
-}
-
-func sendRecipientEmail(recipient *dal.User, offerer *dal.User, event string) {
-
-	to := []string{recipient.Email}
-	auth := smtp.PlainAuth("", recipient.Email, recipient.Password, smtpServer)
-	var msg = []byte{}
-
-	switch event {
-	case "created":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Received\r\n"+
-			"\r\n"+
-			"Congratulations, %s! You received an offer from %s.",
-			recipient.Email, recipient.Name, offerer.Name))
-	case "accepted":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Accepted\r\n"+
-			"\r\n"+
-			"Congratulations, %s! You accepted an offer from %s.",
-			recipient.Email, recipient.Name, offerer.Name))
-	case "rejected":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Rejected\r\n"+
-			"\r\n"+
-			"Hey there, %s. You rejected an offer from %s.",
-			recipient.Email, recipient.Name, offerer.Name))
-	case "cancelled":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Offer Cancelled\r\n"+
-			"\r\n"+
-			"Hey there, %s. The offer from %s was cancelled.",
-			recipient.Email, recipient.Name, offerer.Name))
-	}
-
-	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, recipient.Email, to, msg)
+		return h.fail(ctx, newDelivery(message, retries), fmt.Errorf("decoding %v event: %w", handler.Kind(), err), true)
+	}
+
+	err = handler.Hydrate(event)
 	if err != nil {
-		fmt.Printf("Error sending email: %v\n", err)
+		return h.fail(ctx, newDelivery(message, retries), fmt.Errorf("getting %v details: %w", handler.Kind(), err), false)
+	}
+
+	for _, notification := range handler.Notifications(event) {
+		err := h.notify(ctx, message, retries, notification)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func sendUserEmail(user *dal.User, event string) {
-	to := []string{user.Email}
-	auth := smtp.PlainAuth("", user.Email, user.Password, smtpServer)
-	var msg = []byte{}
+// Sends the notification over every channel routed for its event that the user hasn't turned off,
+// unless they muted the event. Offer emails for users with daily or weekly delivery are held for
+// their digest instead. Deliveries that fail are handed to the retry topic.
+func (h consumerGroupHandler) notify(ctx context.Context, message *sarama.ConsumerMessage, retries int, notification *Notification) error {
+	kind := notification.Kind
+	eventType := notification.Event.Type
 
-	switch event {
-	case "created":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Gametrader Account Created\r\n"+
-			"\r\n"+
-			"Welcome, %s! Your account was successfully created.",
-			user.Email, user.Name))
-	case "updated":
-		msg = []byte(fmt.Sprintf("To: %s\r\n"+
-			"Subject: Gametrader Account Password Updated\r\n"+
-			"\r\n"+
-			"Hey there, %s. Your account's password was successfully updated.",
-			user.Email, user.Name))
+	preferences, err := h.preferences(notification.To.UserId)
+	if err != nil {
+		delivery := newDelivery(message, retries)
+		delivery.Notification = notification
+		return h.fail(ctx, delivery, fmt.Errorf("getting notification preferences: %w", err), false)
 	}
+	if slices.Contains(preferences.MutedEvents, kind+"."+eventType) {
+		return nil
+	}
+
+	for _, channel := range h.routes.For(kind, eventType) {
+		if !slices.Contains(preferences.Channels, channel) {
+			continue
+		}
 
-	err := smtp.SendMail(smtpServer+":"+smtpPort, auth, user.Email, to, msg)
+		if channel == SMTPChannel && kind == "offer" && preferences.Delivery != dal.Immediate {
+			err = h.deliverOnce(message, channel, notification, func() error {
+				return h.digests.Buffer(preferences.Delivery, notification)
+			})
+		} else {
+			err = h.deliverOnce(message, channel, notification, func() error {
+				return deliver(ctx, h.routes.Notifier(channel), notification)
+			})
+		}
+		// A send cut off by the session ending is sent again when the message is consumed again
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			delivery := newDelivery(message, retries)
+			delivery.Notification = notification
+			delivery.Channel = channel
+			err = h.fail(ctx, delivery, fmt.Errorf("sending %v notification over %v: %w", notification.Name, channel, err), false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs send unless the notification has already been delivered over the channel, recording the
+// delivery in the ledger so that redelivered messages don't notify anyone twice. Message is the
+// message the notification's event was consumed from.
+func (h consumerGroupHandler) deliverOnce(message *sarama.ConsumerMessage, channel string, notification *Notification, send func() error) error {
+	eventId := deliveryEventId(message, notification)
+	userId := notification.To.UserId
+
+	claimed, err := h.db.ClaimDelivery(eventId, userId, channel, deliveryLease)
 	if err != nil {
-		fmt.Printf("Error sending email: %v\n", err)
+		return err
+	}
+	if !claimed {
+		fmt.Printf("Skipping %v notification over %v, it was already delivered\n", notification.Name, channel)
+		return nil
+	}
+
+	err = send()
+	if err != nil {
+		releaseErr := h.db.ReleaseDelivery(eventId, userId, channel)
+		if releaseErr != nil {
+			fmt.Printf("Error releasing delivery claim: %v\n", releaseErr)
+		}
+		return err
+	}
+
+	// The notification has gone out, so this is only logged. The claim stops it being sent again
+	// until its lease runs out.
+	err = h.db.CompleteDelivery(eventId, userId, channel)
+	if err != nil {
+		fmt.Printf("Error recording delivery: %v\n", err)
+	}
+	return nil
+}
+
+// Returns the id deliveries of the notification's event are recorded under. Legacy events have no
+// event id, and an offer or user can have several events of the same type, e.g. a user is updated
+// each time they change their password, so they're told apart by the position of the message they
+// were consumed from instead.
+func deliveryEventId(message *sarama.ConsumerMessage, notification *Notification) string {
+	event := notification.Event
+	if !event.IsLegacy() {
+		return event.EventId
+	}
+	return fmt.Sprintf("legacy-%v-%v-%v-%v:%v", notification.Kind, event.Type, event.Key(), message.Partition, message.Offset)
+}
+
+// Returns the user's notification preferences. Users who never saved theirs get every channel,
+// nothing muted and immediate delivery.
+func (h consumerGroupHandler) preferences(userId int) (*dal.Preferences, error) {
+	preferences, err := h.db.GetPreferences(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &dal.Preferences{
+			Channels:    []string{SMTPChannel, WebhookChannel, FileChannel},
+			MutedEvents: []string{},
+			Delivery:    dal.Immediate,
+		}, nil
 	}
+	return preferences, err
 }
@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/robertjshirts/events"
+)
+
+// A consumer group whose Consume calls return the given results in turn, cancelling the context the
+// consumer was started with on the last one
+type fakeConsumerGroup struct {
+	sarama.ConsumerGroup
+	results []error
+	calls   int
+	cancel  context.CancelFunc
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	g.calls++
+	if g.calls == len(g.results) {
+		g.cancel()
+	}
+	return g.results[g.calls-1]
+}
+
+func TestConsumeStopsOnShutdown(t *testing.T) {
+	failed := errors.New("broker unreachable")
+
+	tests := []struct {
+		name    string
+		results []error
+		err     error
+	}{
+		{"consumer group closed", []error{sarama.ErrClosedConsumerGroup}, nil},
+		{"context cancelled", []error{nil}, nil},
+		// Each rebalance ends a session and the group is joined again
+		{"cancelled after rebalancing", []error{nil, nil, nil}, nil},
+		{"consume failed", []error{failed}, failed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			group := &fakeConsumerGroup{results: test.results, cancel: cancel}
+			registry := NewRegistry()
+			registry.Register(offerTopic, NewOfferHandler(nil))
+			kc := &KafkaConsumer{ConsumerGroup: group, registry: registry, retryTopic: "retry"}
+
+			err := kc.Consume(ctx)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if group.calls != len(test.results) {
+				t.Errorf("expected %v sessions, got %v", len(test.results), group.calls)
+			}
+		})
+	}
+}
+
+func TestConsumeClaimFinishesMessageBeforeSessionEnds(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	partition := consumer.ExpectConsumePartition("games", 0, sarama.OffsetOldest)
+	// No handler is registered for the topic, so the message is dead-lettered and marked
+	partition.YieldMessage(&sarama.ConsumerMessage{Key: []byte("1"), Value: []byte("1")})
+	partitionConsumer, err := consumer.ConsumePartition("games", 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer partitionConsumer.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	producer.ExpectSendMessageAndSucceed()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	h := consumerGroupHandler{registry: NewRegistry(), producer: producer, retryTopic: "retry", deadLetterTopic: "dead-letter", workers: 1}
+	done := make(chan error)
+	go func() {
+		done <- h.ConsumeClaim(session, &fakeClaim{PartitionConsumer: partitionConsumer, topic: "games"})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		session.mu.Lock()
+		marked := slices.Clone(session.marked)
+		session.mu.Unlock()
+		if len(marked) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the message to be marked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Ending the session stops the claim without waiting for more messages
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the claim to stop once the session ended")
+	}
+	if !slices.Equal(session.marked, []int64{1}) {
+		t.Errorf("expected only the handled message to be marked, got %v", session.marked)
+	}
+}
+
+func TestDeliverOnce(t *testing.T) {
+	alice := events.User{UserId: 1, Email: "alice@example.com", Name: "Alice"}
+	// Legacy messages only carry the user's id, and each password change sends another one
+	legacy := &Notification{Kind: "user", Name: "user-updated", To: alice, Event: &events.Envelope{Type: events.Updated, User: &alice}}
+	event, err := events.NewEnvelope(events.Updated, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.User = &alice
+	current := &Notification{Kind: "user", Name: "user-updated", To: alice, Event: event}
+
+	message := func(offset int64) *sarama.ConsumerMessage {
+		return &sarama.ConsumerMessage{Topic: "user", Partition: 0, Offset: offset, Key: []byte("1")}
+	}
+
+	tests := []struct {
+		name         string
+		notification *Notification
+		// The offset of each message the notification is consumed from
+		offsets []int64
+		sends   int
+	}{
+		{"legacy event redelivered", legacy, []int64{5, 5}, 1},
+		{"legacy events of the same type", legacy, []int64{5, 6}, 2},
+		{"event redelivered", current, []int64{5, 5}, 1},
+		// An event's id is the same wherever it's consumed from, e.g. when it's replayed
+		{"event replayed", current, []int64{5, 9}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := consumerGroupHandler{db: &fakeDatastore{deliveries: map[string]string{}}}
+			sends := 0
+			for _, offset := range test.offsets {
+				err := handler.deliverOnce(message(offset), SMTPChannel, test.notification, func() error {
+					sends++
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if sends != test.sends {
+				t.Errorf("expected %v sends, got %v", test.sends, sends)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// A message read back from the dead-letter topic
+type DeadLetter struct {
+	Partition int32
+	Offset    int64
+	Delivery  FailedDelivery
+}
+
+// Returns the id the replay command takes for the dead letter.
+func (d *DeadLetter) Id() string {
+	return fmt.Sprintf("%d:%d", d.Partition, d.Offset)
+}
+
+// Reads every message currently in the dead-letter topic. Kafka doesn't delete consumed messages, so
+// this includes ones that have already been replayed.
+func ListDeadLetters(brokers []string, deadLetterTopic string) ([]DeadLetter, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_3_0_0
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	partitions, err := client.Partitions(deadLetterTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetters := []DeadLetter{}
+	for _, partition := range partitions {
+		oldest, err := client.GetOffset(deadLetterTopic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := client.GetOffset(deadLetterTopic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		if oldest >= newest {
+			continue
+		}
+
+		partitionConsumer, err := consumer.ConsumePartition(deadLetterTopic, partition, oldest)
+		if err != nil {
+			return nil, err
+		}
+
+		for offset := oldest; offset < newest; {
+			select {
+			case message := <-partitionConsumer.Messages():
+				offset = message.Offset + 1
+				deadLetter := DeadLetter{Partition: partition, Offset: message.Offset}
+				err := json.Unmarshal(message.Value, &deadLetter.Delivery)
+				if err != nil {
+					fmt.Printf("Skipping unreadable dead letter %v: %v\n", deadLetter.Id(), err)
+					continue
+				}
+				deadLetters = append(deadLetters, deadLetter)
+			case err := <-partitionConsumer.Errors():
+				partitionConsumer.Close()
+				return nil, err
+			case <-time.After(10 * time.Second):
+				partitionConsumer.Close()
+				return nil, fmt.Errorf("timed out reading partition %v of %v", partition, deadLetterTopic)
+			}
+		}
+		partitionConsumer.Close()
+	}
+
+	return deadLetters, nil
+}
+
+// Publishes the dead letters to the retry topic with their retries reset, so they're delivered again
+// straight away.
+func ReplayDeadLetters(brokers []string, retryTopic string, deadLetters []DeadLetter) error {
+	config := sarama.NewConfig()
+	config.Version = sarama.V3_3_0_0
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	for _, deadLetter := range deadLetters {
+		delivery := deadLetter.Delivery
+		delivery.Retries = 0
+		delivery.RetryAt = time.Now().UTC()
+		err := publishDelivery(producer, retryTopic, &delivery)
+		if err != nil {
+			return fmt.Errorf("replaying dead letter %v: %w", deadLetter.Id(), err)
+		}
+	}
+	return nil
+}
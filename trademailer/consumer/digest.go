@@ -0,0 +1,277 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/trademailer/dal"
+)
+
+const (
+	digestPollInterval = time.Minute
+	digestTemplate     = "digest"
+)
+
+// Tells the time. Swapped out in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Sends the templated email used for digests. Send gives up when ctx is done.
+type Mailer interface {
+	Send(ctx context.Context, template string, to events.User, data interface{}) error
+}
+
+type DigestStore interface {
+	CreateDigestEntry(entry *dal.DigestEntry) error
+	GetDigestRecipients(delivery string, before time.Time) ([]int, error)
+	GetDigestEntries(userId int, delivery string, before time.Time) ([]dal.DigestEntry, error)
+	ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error)
+	ReleaseDelivery(eventId string, userId int, channel string) error
+	WithTx(fn func(tx dal.TxStore) error) error
+}
+
+// The data the digest template is rendered with
+type DigestData struct {
+	// The user the digest is addressed to
+	To events.User
+	// daily or weekly
+	Delivery string
+	// The offers that changed since the last digest, grouped by their latest status
+	Pending   []DigestOffer
+	Accepted  []DigestOffer
+	Rejected  []DigestOffer
+	Cancelled []DigestOffer
+	Expired   []DigestOffer
+}
+
+type DigestOffer struct {
+	Offer events.Offer
+	// Whether the digest's user made the offer, rather than received it
+	Sent bool
+}
+
+// Buffers offer emails for users who chose daily or weekly delivery and sends each of them one
+// digest a day (or week) at the configured hour, in UTC.
+type Digester struct {
+	db      DigestStore
+	mailer  Mailer
+	clock   Clock
+	hour    int
+	weekday time.Weekday
+}
+
+// Creates a digester that sends daily digests at the hour and weekly digests on the weekday at the hour.
+func NewDigester(db DigestStore, mailer Mailer, clock Clock, hour int, weekday time.Weekday) (*Digester, error) {
+	if hour < 0 || hour > 23 {
+		return nil, fmt.Errorf("digest hour %v is not between 0 and 23", hour)
+	}
+	if clock == nil {
+		clock = realClock{}
+	}
+	return &Digester{
+		db:      db,
+		mailer:  mailer,
+		clock:   clock,
+		hour:    hour,
+		weekday: weekday,
+	}, nil
+}
+
+// Holds the notification back for the user's next digest.
+func (d *Digester) Buffer(delivery string, notification *Notification) error {
+	value, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return d.db.CreateDigestEntry(&dal.DigestEntry{
+		UserId:       notification.To.UserId,
+		Delivery:     delivery,
+		Notification: string(value),
+		CreatedAt:    d.clock.Now().UTC(),
+	})
+}
+
+// Sends digests as they come due until the context is cancelled.
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(digestPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := d.SendDue(ctx)
+		if err != nil {
+			fmt.Printf("Error sending digests: %v\n", err)
+		}
+	}
+}
+
+// Sends a digest to every user with entries buffered before their delivery mode's most recent send
+// time. Since the cutoff only depends on the clock, digests that were due while trademailer was down
+// go out as soon as it's back.
+func (d *Digester) SendDue(ctx context.Context) error {
+	now := d.clock.Now().UTC()
+	for _, delivery := range []string{dal.Daily, dal.Weekly} {
+		cutoff := d.cutoff(delivery, now)
+
+		userIds, err := d.db.GetDigestRecipients(delivery, cutoff)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range userIds {
+			err := d.sendDigest(ctx, userId, delivery, cutoff)
+			if err != nil {
+				fmt.Printf("Error sending %v digest to user %v: %v\n", delivery, userId, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Sends one user's digest and deletes its entries. The digest is claimed in the deliveries ledger
+// like any other email, so only one trademailer sends it and it isn't sent twice, and no connection
+// or locks are held while it's sent. Its entries are deleted in the same transaction that records it
+// as sent.
+func (d *Digester) sendDigest(ctx context.Context, userId int, delivery string, cutoff time.Time) error {
+	eventId := digestEventId(delivery, cutoff)
+	claimed, err := d.db.ClaimDelivery(eventId, userId, SMTPChannel, deliveryLease)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	err = d.sendEntries(ctx, eventId, userId, delivery, cutoff)
+	if err != nil {
+		releaseErr := d.db.ReleaseDelivery(eventId, userId, SMTPChannel)
+		if releaseErr != nil {
+			fmt.Printf("Error releasing digest claim: %v\n", releaseErr)
+		}
+	}
+	return err
+}
+
+// Sends the digest of the entries buffered before the cutoff, then deletes them and completes the
+// claim on the digest.
+func (d *Digester) sendEntries(ctx context.Context, eventId string, userId int, delivery string, cutoff time.Time) error {
+	entries, err := d.db.GetDigestEntries(userId, delivery, cutoff)
+	if err != nil {
+		return err
+	}
+
+	notifications := []Notification{}
+	ids := []int{}
+	for _, entry := range entries {
+		ids = append(ids, entry.DigestEntryId)
+
+		var notification Notification
+		err := json.Unmarshal([]byte(entry.Notification), &notification)
+		if err != nil {
+			fmt.Printf("Dropping unreadable digest entry %v: %v\n", entry.DigestEntryId, err)
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if len(notifications) > 0 {
+		data := summarize(delivery, notifications)
+		err = d.mailer.Send(ctx, digestTemplate, data.To, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The digest has gone out, so this is only logged. The claim stops it being sent again until its
+	// lease runs out.
+	err = d.db.WithTx(func(tx dal.TxStore) error {
+		err := tx.DeleteDigestEntries(ids)
+		if err != nil {
+			return err
+		}
+		return tx.CompleteDelivery(eventId, userId, SMTPChannel)
+	})
+	if err != nil {
+		fmt.Printf("Error recording digest for user %v: %v\n", userId, err)
+	}
+	return nil
+}
+
+// Returns the id a digest is recorded under in the deliveries ledger. Each user gets one digest of
+// each delivery mode per cutoff.
+func digestEventId(delivery string, cutoff time.Time) string {
+	return fmt.Sprintf("digest-%v-%v", delivery, cutoff.Unix())
+}
+
+// Returns the most recent time at or before now that digests of the delivery mode were due.
+func (d *Digester) cutoff(delivery string, now time.Time) time.Time {
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), d.hour, 0, 0, 0, time.UTC)
+	if cutoff.After(now) {
+		cutoff = cutoff.AddDate(0, 0, -1)
+	}
+	if delivery == dal.Weekly {
+		for cutoff.Weekday() != d.weekday {
+			cutoff = cutoff.AddDate(0, 0, -1)
+		}
+	}
+	return cutoff
+}
+
+// Builds the digest from a user's notifications, oldest first. Each offer is listed once, under the
+// status from its most recent event. Countered offers are left out, since the counter-offer that
+// replaced them is listed instead.
+func summarize(delivery string, notifications []Notification) DigestData {
+	data := DigestData{
+		To:       notifications[len(notifications)-1].To,
+		Delivery: delivery,
+	}
+
+	latest := map[int]*events.Offer{}
+	order := []int{}
+	for _, notification := range notifications {
+		offer := notification.Event.Offer
+		if offer == nil {
+			continue
+		}
+		if _, ok := latest[offer.OfferId]; !ok {
+			order = append(order, offer.OfferId)
+		}
+		latest[offer.OfferId] = offer
+	}
+
+	for _, offerId := range order {
+		offer := latest[offerId]
+		digestOffer := DigestOffer{
+			Offer: *offer,
+			Sent:  offer.Offerer.UserId == data.To.UserId,
+		}
+		switch offer.Status {
+		case string(dal.Pending):
+			data.Pending = append(data.Pending, digestOffer)
+		case string(dal.Accepted):
+			data.Accepted = append(data.Accepted, digestOffer)
+		case string(dal.Rejected):
+			data.Rejected = append(data.Rejected, digestOffer)
+		case string(dal.Cancelled):
+			data.Cancelled = append(data.Cancelled, digestOffer)
+		case string(dal.Expired):
+			data.Expired = append(data.Expired, digestOffer)
+		}
+	}
+
+	return data
+}
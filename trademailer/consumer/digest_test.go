@@ -0,0 +1,284 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/trademailer/dal"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// An in-memory DigestStore and TxStore
+type fakeDigestStore struct {
+	entries []dal.DigestEntry
+	nextId  int
+	// The status of each delivery in the ledger, by event id and user id
+	deliveries map[string]string
+}
+
+func (s *fakeDigestStore) CreateDigestEntry(entry *dal.DigestEntry) error {
+	s.nextId++
+	entry.DigestEntryId = s.nextId
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *fakeDigestStore) GetDigestRecipients(delivery string, before time.Time) ([]int, error) {
+	seen := map[int]bool{}
+	userIds := []int{}
+	for _, entry := range s.entries {
+		if entry.Delivery == delivery && entry.CreatedAt.Before(before) && !seen[entry.UserId] {
+			seen[entry.UserId] = true
+			userIds = append(userIds, entry.UserId)
+		}
+	}
+	return userIds, nil
+}
+
+func (s *fakeDigestStore) WithTx(fn func(tx dal.TxStore) error) error {
+	return fn(s)
+}
+
+func (s *fakeDigestStore) GetDigestEntries(userId int, delivery string, before time.Time) ([]dal.DigestEntry, error) {
+	entries := []dal.DigestEntry{}
+	for _, entry := range s.entries {
+		if entry.UserId == userId && entry.Delivery == delivery && entry.CreatedAt.Before(before) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *fakeDigestStore) ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error) {
+	if s.deliveries == nil {
+		s.deliveries = map[string]string{}
+	}
+	key := deliveryKey(eventId, userId, channel)
+	if _, ok := s.deliveries[key]; ok {
+		return false, nil
+	}
+	s.deliveries[key] = "claimed"
+	return true, nil
+}
+
+func (s *fakeDigestStore) CompleteDelivery(eventId string, userId int, channel string) error {
+	s.deliveries[deliveryKey(eventId, userId, channel)] = "sent"
+	return nil
+}
+
+func (s *fakeDigestStore) ReleaseDelivery(eventId string, userId int, channel string) error {
+	delete(s.deliveries, deliveryKey(eventId, userId, channel))
+	return nil
+}
+
+func (s *fakeDigestStore) DeleteDigestEntries(ids []int) error {
+	kept := []dal.DigestEntry{}
+	for _, entry := range s.entries {
+		deleted := false
+		for _, id := range ids {
+			deleted = deleted || entry.DigestEntryId == id
+		}
+		if !deleted {
+			kept = append(kept, entry)
+		}
+	}
+	s.entries = kept
+	return nil
+}
+
+// Records the digests it sends, or fails every send with err
+type fakeMailer struct {
+	sent []DigestData
+	err  error
+}
+
+func (m *fakeMailer) Send(ctx context.Context, template string, to events.User, data interface{}) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, data.(DigestData))
+	return nil
+}
+
+func TestDigestCutoff(t *testing.T) {
+	d, err := NewDigester(nil, nil, nil, 8, time.Monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wednesday 2024-03-13
+	tests := []struct {
+		delivery string
+		now      time.Time
+		cutoff   time.Time
+	}{
+		{dal.Daily, time.Date(2024, 3, 13, 9, 30, 0, 0, time.UTC), time.Date(2024, 3, 13, 8, 0, 0, 0, time.UTC)},
+		{dal.Daily, time.Date(2024, 3, 13, 8, 0, 0, 0, time.UTC), time.Date(2024, 3, 13, 8, 0, 0, 0, time.UTC)},
+		{dal.Daily, time.Date(2024, 3, 13, 7, 59, 0, 0, time.UTC), time.Date(2024, 3, 12, 8, 0, 0, 0, time.UTC)},
+		{dal.Weekly, time.Date(2024, 3, 13, 9, 30, 0, 0, time.UTC), time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)},
+		{dal.Weekly, time.Date(2024, 3, 11, 7, 0, 0, 0, time.UTC), time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		cutoff := d.cutoff(test.delivery, test.now)
+		if !cutoff.Equal(test.cutoff) {
+			t.Errorf("%v cutoff at %v = %v, want %v", test.delivery, test.now, cutoff, test.cutoff)
+		}
+	}
+}
+
+func TestDigesterSendsDueEntries(t *testing.T) {
+	store := &fakeDigestStore{}
+	mailer := &fakeMailer{}
+	clock := &fakeClock{now: time.Date(2024, 3, 13, 7, 0, 0, 0, time.UTC)}
+	d, err := NewDigester(store, mailer, clock, 8, time.Monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offerer := events.User{UserId: 1, Name: "John Doe", Email: "johndoe@gmail.com"}
+	recipient := events.User{UserId: 2, Name: "Jane Doe", Email: "janedoe@gmail.com"}
+	notification := func(offerId int, eventType string, status dal.StatusCondition) *Notification {
+		return &Notification{
+			Name: "offer-" + eventType + "-offerer",
+			To:   offerer,
+			Event: &events.Envelope{
+				Type:  eventType,
+				Offer: &events.Offer{OfferId: offerId, Status: string(status), Offerer: offerer, Recipient: recipient},
+			},
+		}
+	}
+
+	// Buffered before the 8:00 send
+	for _, n := range []*Notification{
+		notification(1, events.Created, dal.Pending),
+		notification(1, events.Accepted, dal.Accepted),
+		notification(2, events.Created, dal.Pending),
+		notification(4, events.Created, dal.Pending),
+		notification(4, events.Expired, dal.Expired),
+		notification(5, events.Created, dal.Pending),
+		notification(5, events.Countered, dal.Countered),
+	} {
+		err := d.Buffer(dal.Daily, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is due until 8:00
+	err = d.SendDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.sent) != 0 {
+		t.Fatalf("sent %v digests before they were due", len(mailer.sent))
+	}
+
+	// Buffered after the 8:00 send, so it waits for tomorrow's
+	clock.now = time.Date(2024, 3, 13, 8, 30, 0, 0, time.UTC)
+	err = d.Buffer(dal.Daily, notification(3, events.Created, dal.Pending))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.SendDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mailer.sent) != 1 {
+		t.Fatalf("sent %v digests, want 1", len(mailer.sent))
+	}
+
+	digest := mailer.sent[0]
+	if digest.To.UserId != offerer.UserId {
+		t.Errorf("digest sent to user %v, want %v", digest.To.UserId, offerer.UserId)
+	}
+	if len(digest.Accepted) != 1 || digest.Accepted[0].Offer.OfferId != 1 || !digest.Accepted[0].Sent {
+		t.Errorf("accepted offers = %+v, want offer 1 sent by the user", digest.Accepted)
+	}
+	if len(digest.Pending) != 1 || digest.Pending[0].Offer.OfferId != 2 {
+		t.Errorf("pending offers = %+v, want offer 2", digest.Pending)
+	}
+	if len(digest.Expired) != 1 || digest.Expired[0].Offer.OfferId != 4 {
+		t.Errorf("expired offers = %+v, want offer 4", digest.Expired)
+	}
+	if len(store.entries) != 1 || store.entries[0].CreatedAt != clock.now {
+		t.Errorf("%v entries left after sending, want only the one buffered after 8:00", len(store.entries))
+	}
+}
+
+func TestDigestSentOnce(t *testing.T) {
+	user := events.User{UserId: 1, Name: "John Doe", Email: "johndoe@gmail.com"}
+	buffered := time.Date(2024, 3, 13, 7, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 13, 8, 30, 0, 0, time.UTC)
+	cutoff := time.Date(2024, 3, 13, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// The digest's ledger entry before sending, if it has one
+		ledger string
+		err    error
+		sent   int
+		// Whether the entries are deleted
+		deleted bool
+		// The digest's ledger entry after sending
+		after string
+	}{
+		{"sent", "", nil, 1, true, "sent"},
+		{"claimed by another trademailer", "claimed", nil, 0, false, "claimed"},
+		{"already sent", "sent", nil, 0, false, "sent"},
+		{"send failed", "", errors.New("connection refused"), 0, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &fakeDigestStore{deliveries: map[string]string{}}
+			key := deliveryKey(digestEventId(dal.Daily, cutoff), user.UserId, SMTPChannel)
+			if test.ledger != "" {
+				store.deliveries[key] = test.ledger
+			}
+			mailer := &fakeMailer{err: test.err}
+			clock := &fakeClock{now: buffered}
+			d, err := NewDigester(store, mailer, clock, 8, time.Monday)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = d.Buffer(dal.Daily, &Notification{
+				Name: "offer-created-offerer",
+				To:   user,
+				Event: &events.Envelope{
+					Type:  events.Created,
+					Offer: &events.Offer{OfferId: 1, Status: string(dal.Pending), Offerer: user},
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock.now = due
+			err = d.SendDue(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(mailer.sent) != test.sent {
+				t.Errorf("expected %v digests to be sent, got %v", test.sent, len(mailer.sent))
+			}
+			if deleted := len(store.entries) == 0; deleted != test.deleted {
+				t.Errorf("expected the entries to be deleted %v, got %v", test.deleted, deleted)
+			}
+			if store.deliveries[key] != test.after {
+				t.Errorf("expected the digest's ledger entry to be %q, got %q", test.after, store.deliveries[key])
+			}
+		})
+	}
+}
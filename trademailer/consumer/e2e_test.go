@@ -0,0 +1,335 @@
+package consumer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/trademailer/dal"
+	"github.com/robertjshirts/trademailer/email"
+	"github.com/robertjshirts/trademailer/smtptest"
+)
+
+const offerTopic = "offer"
+
+// An in-memory Datastore with no saved preferences, so every user gets the defaults
+type fakeDatastore struct {
+	mu         sync.Mutex
+	deliveries map[string]string
+}
+
+func (d *fakeDatastore) GetOfferDetails(offerId int) (*dal.Offer, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (d *fakeDatastore) GetUserDetails(userId int) (*dal.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (d *fakeDatastore) GetGameDetails(gameId int) (*dal.Game, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (d *fakeDatastore) GetPreferences(userId int) (*dal.Preferences, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (d *fakeDatastore) ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := deliveryKey(eventId, userId, channel)
+	if _, ok := d.deliveries[key]; ok {
+		return false, nil
+	}
+	d.deliveries[key] = "claimed"
+	return true, nil
+}
+
+func (d *fakeDatastore) CompleteDelivery(eventId string, userId int, channel string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries[deliveryKey(eventId, userId, channel)] = "sent"
+	return nil
+}
+
+func (d *fakeDatastore) ReleaseDelivery(eventId string, userId int, channel string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.deliveries, deliveryKey(eventId, userId, channel))
+	return nil
+}
+
+func deliveryKey(eventId string, userId int, channel string) string {
+	return fmt.Sprintf("%v/%v/%v", eventId, userId, channel)
+}
+
+// A consumer group session for a single claim that records the messages marked in it
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return map[string][]int32{offerTopic: {0}} }
+func (s *fakeSession) MemberID() string           { return "e2e" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, offset)
+}
+func (s *fakeSession) Commit() {}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+// Claims the partition of a mock consumer
+type fakeClaim struct {
+	sarama.PartitionConsumer
+	topic     string
+	partition int32
+}
+
+func (c *fakeClaim) Topic() string        { return c.topic }
+func (c *fakeClaim) Partition() int32     { return c.partition }
+func (c *fakeClaim) InitialOffset() int64 { return sarama.OffsetOldest }
+func (c *fakeClaim) HighWaterMarkOffset() int64 {
+	return c.PartitionConsumer.HighWaterMarkOffset()
+}
+
+func TestOfferCreatedEmailsBothParties(t *testing.T) {
+	server, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	templates, err := email.LoadTemplates("../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	smtpNotifier, err := NewSMTPNotifier(SMTPConfig{
+		Host:    server.Host(),
+		Port:    server.Port(),
+		From:    "trades@gametrader.test",
+		TLSMode: NoTLS,
+	}, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := NewRoutes(map[string]Notifier{SMTPChannel: smtpNotifier}, map[string]string{defaultRoute: SMTPChannel})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests, err := NewDigester(&fakeDigestStore{}, &fakeMailer{}, &fakeClock{}, 8, time.Monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &fakeDatastore{deliveries: map[string]string{}}
+	registry := NewRegistry()
+	err = registry.Register(offerTopic, NewOfferHandler(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing should fail, so nothing should be published to the retry or dead-letter topics
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+
+	handler := consumerGroupHandler{
+		db:              db,
+		registry:        registry,
+		routes:          routes,
+		digests:         digests,
+		producer:        producer,
+		retryTopic:      "notification-retry",
+		deadLetterTopic: "notification-dead-letter",
+		workers:         2,
+	}
+
+	// Publish the event
+	event, err := events.NewEnvelope(events.Created, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event.Offer = &events.Offer{
+		OfferId:   42,
+		Status:    "pending",
+		Offerer:   events.User{UserId: 1, Email: "alice@example.com", Name: "Alice"},
+		Recipient: events.User{UserId: 2, Email: "bob@example.com", Name: "Bob"},
+		OffererGames: []events.Game{
+			{GameId: 10, Name: "Halo", System: "Xbox", Condition: "good"},
+			{GameId: 11, Name: "Fable", System: "Xbox", Condition: "fair"},
+		},
+		RecipientGames: []events.Game{{GameId: 20, Name: "Zelda", System: "Switch", Condition: "mint"}},
+	}
+	value, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kafka := mocks.NewConsumer(t, nil)
+	defer kafka.Close()
+	kafka.ExpectConsumePartition(offerTopic, 0, sarama.OffsetOldest).YieldMessage(&sarama.ConsumerMessage{
+		Key:   []byte(event.Key()),
+		Value: value,
+	})
+	partition, err := kafka.ConsumePartition(offerTopic, 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closing the partition ends the claim once the message has been handled
+	partition.AsyncClose()
+
+	session := &fakeSession{ctx: context.Background()}
+	err = handler.ConsumeClaim(session, &fakeClaim{PartitionConsumer: partition, topic: offerTopic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := server.WaitForMessages(2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 emails, got %v", len(messages))
+	}
+
+	trade := "The trade:\n" +
+		"  Alice gives Halo (Xbox, good condition), Fable (Xbox, fair condition)\n" +
+		"  Bob gives Zelda (Switch, mint condition)\n" +
+		"\n" +
+		"-- The Gametrader team"
+	expected := map[string]struct {
+		name    string
+		subject string
+		text    string
+	}{
+		"alice@example.com": {
+			name:    "Alice",
+			subject: "Offer Successfully Created",
+			text:    "Congratulations, Alice! Your offer to Bob was successfully created!\n\n" + trade,
+		},
+		"bob@example.com": {
+			name:    "Bob",
+			subject: "Offer Received",
+			text:    "Congratulations, Bob! You received an offer from Alice.\n\n" + trade,
+		},
+	}
+
+	for _, message := range messages {
+		if message.From != "trades@gametrader.test" {
+			t.Errorf("expected the envelope to be from the configured sender, got %v", message.From)
+		}
+		if len(message.To) != 1 {
+			t.Fatalf("expected one recipient, got %v", message.To)
+		}
+		to := message.To[0]
+		want, ok := expected[to]
+		if !ok {
+			t.Fatalf("unexpected email to %v", to)
+		}
+		delete(expected, to)
+
+		parsed, err := mail.ReadMessage(strings.NewReader(string(message.Data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, err := mail.ParseAddress(parsed.Header.Get("From"))
+		if err != nil || from.Address != "trades@gametrader.test" {
+			t.Errorf("unexpected From header %q", parsed.Header.Get("From"))
+		}
+		recipient, err := mail.ParseAddress(parsed.Header.Get("To"))
+		if err != nil || recipient.Address != to || recipient.Name != want.name {
+			t.Errorf("unexpected To header %q", parsed.Header.Get("To"))
+		}
+		if parsed.Header.Get("Subject") != want.subject {
+			t.Errorf("expected subject %q to %v, got %q", want.subject, to, parsed.Header.Get("Subject"))
+		}
+
+		text := textPart(t, parsed)
+		if text != want.text {
+			t.Errorf("unexpected text to %v:\n%v\nwant:\n%v", to, text, want.text)
+		}
+	}
+
+	if len(session.marked) != 1 || session.marked[0] != 1 {
+		t.Errorf("expected the message to be marked, got offsets %v", session.marked)
+	}
+}
+
+func TestPrimingMessageSkipped(t *testing.T) {
+	db := &fakeDatastore{deliveries: map[string]string{}}
+	registry := NewRegistry()
+	err := registry.Register(offerTopic, NewOfferHandler(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The message isn't an event, but it mustn't be dead-lettered either
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+
+	handler := consumerGroupHandler{
+		db:              db,
+		registry:        registry,
+		producer:        producer,
+		retryTopic:      "notification-retry",
+		deadLetterTopic: "notification-dead-letter",
+		workers:         1,
+	}
+	err = handler.handle(context.Background(), &sarama.ConsumerMessage{
+		Topic: offerTopic,
+		Key:   []byte("init"),
+		Value: []byte("init"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Returns the decoded text/plain part of a multipart/alternative email.
+func textPart(t *testing.T, message *mail.Message) string {
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative email, got %v", mediaType)
+	}
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			t.Fatal("email has no text/plain part")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			body, err := io.ReadAll(part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return strings.ReplaceAll(string(body), "\r\n", "\n")
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// Writes notifications as JSON lines to a file or stdout. Meant for local development.
+type FileNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Opens the file for appending, creating it if needed. A path of "-" writes to stdout.
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	if path == "-" {
+		return &FileNotifier{w: os.Stdout}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileNotifier{w: file}, nil
+}
+
+func (f *FileNotifier) Notify(ctx context.Context, notification *Notification) error {
+	line, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err = f.w.Write(append(line, '\n'))
+	return err
+}
+
+// Closes the file, unless it's stdout.
+func (f *FileNotifier) Close() error {
+	if closer, ok := f.w.(io.Closer); ok && f.w != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package consumer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/robertjshirts/events"
+)
+
+// Turns the messages on a topic into notifications. Implement it and register it for a topic to add
+// a new family of events.
+type EventHandler interface {
+	// The family of events the handler handles, e.g. "offer". Notification names, routes and
+	// preferences are keyed by it.
+	Kind() string
+	// Decodes a message. Errors are permanent: the message is dead-lettered without being retried.
+	Decode(key []byte, value []byte) (*events.Envelope, error)
+	// Fills in whatever the event is missing before it can be notified, e.g. the snapshot of legacy
+	// events. Errors are retried.
+	Hydrate(event *events.Envelope) error
+	// Returns a notification for each user the event should notify.
+	Notifications(event *events.Envelope) []*Notification
+}
+
+// Maps configured topic names to the handlers for their messages
+type Registry struct {
+	handlers map[string]EventHandler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[string]EventHandler{}}
+}
+
+func (r *Registry) Register(topic string, handler EventHandler) error {
+	if topic == "" {
+		return fmt.Errorf("no topic provided for %v events", handler.Kind())
+	}
+	if existing, ok := r.handlers[topic]; ok {
+		return fmt.Errorf("topic %v already has a handler for %v events", topic, existing.Kind())
+	}
+	r.handlers[topic] = handler
+	return nil
+}
+
+func (r *Registry) Handler(topic string) (EventHandler, bool) {
+	handler, ok := r.handlers[topic]
+	return handler, ok
+}
+
+// Returns the registered topics in order.
+func (r *Registry) Topics() []string {
+	topics := []string{}
+	for topic := range r.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Builds the notification about the event for one user. Role distinguishes the users an event
+// notifies, e.g. "offerer" or "recipient", and is empty for events that only notify one user.
+func newNotification(kind string, event *events.Envelope, role string, to events.User) *Notification {
+	name := kind + "-" + event.Type
+	if role != "" {
+		name += "-" + role
+	}
+	return &Notification{
+		Kind:  kind,
+		Name:  name,
+		To:    to,
+		Event: event,
+	}
+}
+
+// ------------------- Offers -------------------//
+
+// Notifies both users in an offer
+type OfferHandler struct {
+	db Datastore
+}
+
+func NewOfferHandler(db Datastore) *OfferHandler {
+	return &OfferHandler{db: db}
+}
+
+func (OfferHandler) Kind() string { return "offer" }
+
+func (OfferHandler) Decode(key []byte, value []byte) (*events.Envelope, error) {
+	return events.DecodeOfferEvent(key, value)
+}
+
+// Fills in the offer snapshot of legacy events, which only carry the offer id, from the database.
+func (o *OfferHandler) Hydrate(event *events.Envelope) error {
+	if !event.IsLegacy() {
+		return nil
+	}
+
+	offer, err := o.db.GetOfferDetails(event.Offer.OfferId)
+	if err != nil {
+		return err
+	}
+
+	offerer, err := userSnapshot(o.db, offer.OffererUserId)
+	if err != nil {
+		return err
+	}
+	recipient, err := userSnapshot(o.db, offer.RecipientUserId)
+	if err != nil {
+		return err
+	}
+	offererGames, err := gameSnapshots(o.db, offer.OffererGameIds)
+	if err != nil {
+		return err
+	}
+	recipientGames, err := gameSnapshots(o.db, offer.RecipientGameIds)
+	if err != nil {
+		return err
+	}
+
+	event.Offer = &events.Offer{
+		OfferId:        event.Offer.OfferId,
+		Status:         string(offer.Status),
+		Offerer:        *offerer,
+		Recipient:      *recipient,
+		OffererGames:   offererGames,
+		RecipientGames: recipientGames,
+	}
+	return nil
+}
+
+func (o *OfferHandler) Notifications(event *events.Envelope) []*Notification {
+	return []*Notification{
+		newNotification(o.Kind(), event, "offerer", event.Offer.Offerer),
+		newNotification(o.Kind(), event, "recipient", event.Offer.Recipient),
+	}
+}
+
+// ------------------- Users -------------------//
+
+// Notifies the user an account event is about
+type UserHandler struct {
+	db Datastore
+}
+
+func NewUserHandler(db Datastore) *UserHandler {
+	return &UserHandler{db: db}
+}
+
+func (UserHandler) Kind() string { return "user" }
+
+func (UserHandler) Decode(key []byte, value []byte) (*events.Envelope, error) {
+	return events.DecodeUserEvent(key, value)
+}
+
+// Fills in the user snapshot of legacy events from the database.
+func (u *UserHandler) Hydrate(event *events.Envelope) error {
+	if !event.IsLegacy() {
+		return nil
+	}
+
+	user, err := userSnapshot(u.db, event.User.UserId)
+	if err != nil {
+		return err
+	}
+	event.User = user
+	return nil
+}
+
+func (u *UserHandler) Notifications(event *events.Envelope) []*Notification {
+	return []*Notification{
+		newNotification(u.Kind(), event, "", *event.User),
+	}
+}
+
+// ------------------- Helpers -------------------//
+
+func userSnapshot(db Datastore, userId int) (*events.User, error) {
+	user, err := db.GetUserDetails(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &events.User{
+		UserId: userId,
+		Email:  user.Email,
+		Name:   user.Name,
+	}, nil
+}
+
+func gameSnapshot(db Datastore, gameId int) (*events.Game, error) {
+	game, err := db.GetGameDetails(gameId)
+	if err != nil {
+		return nil, err
+	}
+	return &events.Game{
+		GameId:    game.GameId,
+		Name:      game.Name,
+		System:    game.System,
+		Condition: string(game.Condition),
+	}, nil
+}
+
+func gameSnapshots(db Datastore, gameIds []int) ([]events.Game, error) {
+	games := []events.Game{}
+	for _, gameId := range gameIds {
+		game, err := gameSnapshot(db, gameId)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, *game)
+	}
+	return games, nil
+}
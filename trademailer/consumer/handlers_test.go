@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/trademailer/dal"
+)
+
+// A Datastore holding the details legacy events are hydrated from. Methods the tests don't use aren't
+// implemented.
+type fakeDetailsStore struct {
+	Datastore
+	offers map[int]*dal.Offer
+	users  map[int]*dal.User
+	games  map[int]*dal.Game
+}
+
+func newFakeDetailsStore() *fakeDetailsStore {
+	return &fakeDetailsStore{
+		offers: map[int]*dal.Offer{7: {OffererUserId: 1, RecipientUserId: 2, OffererGameIds: []int{10}, RecipientGameIds: []int{20}, Status: dal.Accepted}},
+		users:  map[int]*dal.User{1: {Email: "alice@example.com", Name: "Alice"}, 2: {Email: "bob@example.com", Name: "Bob"}},
+		games:  map[int]*dal.Game{10: {GameId: 10, Name: "Zelda", System: "NES"}, 20: {GameId: 20, Name: "Metroid", System: "NES"}},
+	}
+}
+
+func (d *fakeDetailsStore) GetOfferDetails(offerId int) (*dal.Offer, error) {
+	if offer, ok := d.offers[offerId]; ok {
+		return offer, nil
+	}
+	return nil, errors.New("no such offer")
+}
+
+func (d *fakeDetailsStore) GetUserDetails(userId int) (*dal.User, error) {
+	if user, ok := d.users[userId]; ok {
+		return user, nil
+	}
+	return nil, errors.New("no such user")
+}
+
+func (d *fakeDetailsStore) GetGameDetails(gameId int) (*dal.Game, error) {
+	if game, ok := d.games[gameId]; ok {
+		return game, nil
+	}
+	return nil, errors.New("no such game")
+}
+
+// Encodes a versioned event the way gametrader publishes it
+func encodeEvent(t *testing.T, eventType string, fill func(event *events.Envelope)) []byte {
+	t.Helper()
+	event, err := events.NewEnvelope(eventType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(event)
+	value, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestRegistry(t *testing.T) {
+	db := newFakeDetailsStore()
+	registry := NewRegistry()
+	err := registry.Register("user", NewUserHandler(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = registry.Register("offer", NewOfferHandler(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := registry.Register("offer", NewUserHandler(db)); err == nil {
+		t.Error("expected registering a second handler for a topic to fail")
+	}
+	if err := registry.Register("", NewOfferHandler(db)); err == nil {
+		t.Error("expected registering a handler without a topic to fail")
+	}
+	if topics := registry.Topics(); !slices.Equal(topics, []string{"offer", "user"}) {
+		t.Errorf("expected the topics in order, got %v", topics)
+	}
+
+	tests := []struct {
+		topic string
+		kind  string
+	}{
+		{"offer", "offer"},
+		{"user", "user"},
+		{"games", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.topic, func(t *testing.T) {
+			handler, ok := registry.Handler(test.topic)
+			if ok != (test.kind != "") {
+				t.Fatalf("expected a handler to be found to be %v, got %v", test.kind != "", ok)
+			}
+			if ok && handler.Kind() != test.kind {
+				t.Errorf("expected the %v handler, got %v", test.kind, handler.Kind())
+			}
+		})
+	}
+}
+
+func TestHandlerNotifications(t *testing.T) {
+	alice := events.User{UserId: 1, Email: "alice@example.com", Name: "Alice"}
+	bob := events.User{UserId: 2, Email: "bob@example.com", Name: "Bob"}
+	// The snapshot carried by versioned events, which differs from the database so hydrating it would show
+	snapshot := events.User{UserId: 1, Email: "alice@new.example.com", Name: "Alice"}
+
+	tests := []struct {
+		name    string
+		handler EventHandler
+		key     string
+		value   []byte
+		// The notifications the event should produce, by name, and who they're addressed to
+		names []string
+		to    []events.User
+	}{
+		{"legacy offer event", NewOfferHandler(newFakeDetailsStore()), events.Accepted, []byte("7"),
+			[]string{"offer-accepted-offerer", "offer-accepted-recipient"}, []events.User{alice, bob}},
+		{"offer event", NewOfferHandler(&fakeDetailsStore{}), "7", encodeEvent(t, events.Accepted, func(event *events.Envelope) {
+			event.Offer = &events.Offer{OfferId: 7, Status: events.Accepted, Offerer: snapshot, Recipient: bob}
+		}), []string{"offer-accepted-offerer", "offer-accepted-recipient"}, []events.User{snapshot, bob}},
+		{"legacy user event", NewUserHandler(newFakeDetailsStore()), events.Created, []byte("1"),
+			[]string{"user-created"}, []events.User{alice}},
+		{"user event", NewUserHandler(&fakeDetailsStore{}), "1", encodeEvent(t, events.Created, func(event *events.Envelope) {
+			event.User = &snapshot
+		}), []string{"user-created"}, []events.User{snapshot}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, err := test.handler.Decode([]byte(test.key), test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = test.handler.Hydrate(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			notifications := test.handler.Notifications(event)
+			if len(notifications) != len(test.names) {
+				t.Fatalf("expected %v notifications, got %v", len(test.names), len(notifications))
+			}
+			for i, notification := range notifications {
+				if notification.Name != test.names[i] || notification.Kind != test.handler.Kind() {
+					t.Errorf("expected a %v notification, got %v (%v)", test.names[i], notification.Name, notification.Kind)
+				}
+				if notification.To != test.to[i] {
+					t.Errorf("expected %v to be sent to %+v, got %+v", notification.Name, test.to[i], notification.To)
+				}
+			}
+		})
+	}
+}
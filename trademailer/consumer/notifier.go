@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/robertjshirts/events"
+)
+
+// Notification channels, as named in the notifier config
+const (
+	SMTPChannel    = "smtp"
+	WebhookChannel = "webhook"
+	FileChannel    = "file"
+)
+
+// The route used for events that don't have one of their own
+const defaultRoute = "default"
+
+// One message about an event, addressed to one user
+type Notification struct {
+	// The family of event the notification is about, e.g. "offer". Routes are keyed by it.
+	Kind string `json:"kind"`
+	// Names the message, e.g. "offer-accepted-offerer". Email templates are looked up by it.
+	Name string `json:"notification"`
+	// The user the notification is addressed to
+	To events.User `json:"to"`
+	// The event, with its snapshot filled in even for legacy events
+	Event *events.Envelope `json:"event"`
+}
+
+// Delivers notifications over one channel. Notify gives up when ctx is done.
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// Picks the notifiers for each event. Routes are keyed by "<kind>.<type>", e.g. "offer.accepted",
+// and list channel names separated by commas. Events without a route use the default route.
+type Routes struct {
+	notifiers map[string]Notifier
+	routes    map[string][]string
+}
+
+// Builds routes from the notifier config. Every channel a route names must be in notifiers.
+func NewRoutes(notifiers map[string]Notifier, config map[string]string) (*Routes, error) {
+	r := &Routes{
+		notifiers: notifiers,
+		routes:    map[string][]string{},
+	}
+	for key, value := range config {
+		if key != defaultRoute && !strings.Contains(key, ".") {
+			continue
+		}
+
+		var route []string
+		for _, channel := range strings.Split(value, ",") {
+			channel = strings.TrimSpace(channel)
+			if channel == "" {
+				continue
+			}
+			if _, ok := notifiers[channel]; !ok {
+				return nil, fmt.Errorf("route %v uses unknown or unconfigured channel %q", key, channel)
+			}
+			route = append(route, channel)
+		}
+		r.routes[key] = route
+	}
+	return r, nil
+}
+
+// Returns the channels for events of the given kind ("offer" or "user") and type.
+func (r *Routes) For(kind string, eventType string) []string {
+	if route, ok := r.routes[kind+"."+eventType]; ok {
+		return route
+	}
+	return r.routes[defaultRoute]
+}
+
+func (r *Routes) Notifier(channel string) Notifier {
+	return r.notifiers[channel]
+}
@@ -0,0 +1,226 @@
+package consumer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/robertjshirts/events"
+
+	"github.com/robertjshirts/trademailer/dal"
+)
+
+// A Notifier that records the names of the notifications it was given
+type recordingNotifier struct {
+	sent []string
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification *Notification) error {
+	n.sent = append(n.sent, notification.Name)
+	return nil
+}
+
+// A Datastore holding users' notification preferences. Methods the tests don't use aren't implemented.
+type fakePreferencesStore struct {
+	Datastore
+	preferences map[int]*dal.Preferences
+}
+
+func (s *fakePreferencesStore) GetPreferences(userId int) (*dal.Preferences, error) {
+	preferences, ok := s.preferences[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return preferences, nil
+}
+
+// Every delivery is new to the ledger
+func (s *fakePreferencesStore) ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error) {
+	return true, nil
+}
+func (s *fakePreferencesStore) CompleteDelivery(eventId string, userId int, channel string) error {
+	return nil
+}
+func (s *fakePreferencesStore) ReleaseDelivery(eventId string, userId int, channel string) error {
+	return nil
+}
+
+func testNotification() *Notification {
+	return &Notification{
+		Name:  "offer-accepted-offerer",
+		To:    events.User{UserId: 1, Email: "alice@example.com", Name: "Alice"},
+		Event: &events.Envelope{EventId: "event-1", Type: events.Accepted},
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	notifiers := map[string]Notifier{SMTPChannel: &recordingNotifier{}, WebhookChannel: &recordingNotifier{}}
+	routes, err := NewRoutes(notifiers, map[string]string{
+		"default":        "smtp",
+		"offer.accepted": "smtp, webhook",
+		"user.updated":   "",
+		// Settings that aren't routes are ignored
+		"webhookUrl": "http://localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		kind      string
+		eventType string
+		expected  []string
+	}{
+		{"offer", "accepted", []string{SMTPChannel, WebhookChannel}},
+		{"offer", "rejected", []string{SMTPChannel}},
+		{"user", "updated", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.kind+"."+test.eventType, func(t *testing.T) {
+			route := routes.For(test.kind, test.eventType)
+			if !slices.Equal(route, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, route)
+			}
+		})
+	}
+
+	_, err = NewRoutes(notifiers, map[string]string{"offer.created": "file"})
+	if err == nil {
+		t.Error("expected a route to an unconfigured channel to fail")
+	}
+}
+
+func TestNotifyHonoursPreferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences *dal.Preferences
+		// The channels the notification should go out over
+		expected []string
+	}{
+		{"never saved", nil, []string{SMTPChannel, WebhookChannel}},
+		{"one channel", &dal.Preferences{Channels: []string{WebhookChannel, FileChannel}, Delivery: dal.Immediate}, []string{WebhookChannel}},
+		{"no channels", &dal.Preferences{Channels: []string{}, Delivery: dal.Immediate}, nil},
+		{"event muted", &dal.Preferences{Channels: []string{SMTPChannel, WebhookChannel}, MutedEvents: []string{"offer.accepted"}, Delivery: dal.Immediate}, nil},
+		{"other event muted", &dal.Preferences{Channels: []string{SMTPChannel}, MutedEvents: []string{"offer.rejected"}, Delivery: dal.Immediate}, []string{SMTPChannel}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifiers := map[string]Notifier{SMTPChannel: &recordingNotifier{}, WebhookChannel: &recordingNotifier{}}
+			routes, err := NewRoutes(notifiers, map[string]string{"default": "smtp, webhook"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			db := &fakePreferencesStore{preferences: map[int]*dal.Preferences{}}
+			if test.preferences != nil {
+				db.preferences[1] = test.preferences
+			}
+			h := consumerGroupHandler{db: db, routes: routes}
+
+			event := &events.Envelope{EventId: "event-1", Type: events.Accepted, Offer: &events.Offer{OfferId: 1}}
+			err = h.notify(context.Background(), &sarama.ConsumerMessage{Topic: "offer"}, 0, newNotification("offer", event, "offerer", events.User{UserId: 1, Email: "alice@example.com"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sent []string
+			for _, channel := range []string{SMTPChannel, WebhookChannel} {
+				if len(notifiers[channel].(*recordingNotifier).sent) > 0 {
+					sent = append(sent, channel)
+				}
+			}
+			if !slices.Equal(sent, test.expected) {
+				t.Errorf("expected the notification over %v, got %v", test.expected, sent)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		sent   bool
+	}{
+		{"accepted", http.StatusNoContent, true},
+		{"refused", http.StatusInternalServerError, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var signed bool
+			var received Notification
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				signed = r.Header.Get(SignatureHeader) == "sha256="+Sign([]byte("secret"), r.Header.Get(TimestampHeader), body)
+				json.Unmarshal(body, &received)
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			notifier, err := NewWebhookNotifier(server.URL, "secret", time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = notifier.Notify(context.Background(), testNotification())
+			if test.sent && err != nil {
+				t.Fatal(err)
+			}
+			if !test.sent && err == nil {
+				t.Fatal("expected the notification to fail")
+			}
+
+			if !signed {
+				t.Error("expected the webhook to be signed with the shared secret")
+			}
+			if received.Name != "offer-accepted-offerer" || received.To.Email != "alice@example.com" || received.Event.EventId != "event-1" {
+				t.Errorf("expected the notification as the body, got %+v", received)
+			}
+		})
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications.jsonl")
+	notifier, err := NewFileNotifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = notifier.Notify(context.Background(), testNotification())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = notifier.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var notification Notification
+		err := json.Unmarshal(scanner.Bytes(), &notification)
+		if err != nil {
+			t.Fatalf("expected a JSON line, got %q: %v", scanner.Text(), err)
+		}
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("expected a line per notification, got %v", lines)
+	}
+}
@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// Attempts made in process before a delivery is handed to the retry topic
+	deliveryAttempts = 3
+	deliveryBackoff  = time.Second
+	// How long a claim on a delivery is held before another consumer may take it over. Longer than
+	// a delivery and its in-process retries can take.
+	deliveryLease = 10 * time.Minute
+	// Attempts made from the retry topic before a delivery is dead-lettered
+	maxRetries      = 5
+	retryBackoff    = time.Minute
+	maxRetryBackoff = time.Hour
+	// Backoff between attempts to publish a failed delivery when the retry or dead-letter topic
+	// can't take it
+	publishBackoff    = time.Second
+	maxPublishBackoff = time.Minute
+)
+
+// A delivery that failed, as published to the retry and dead-letter topics
+type FailedDelivery struct {
+	// The message the delivery was for
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	// The notification and the channel it failed on. The notification is nil if the message itself
+	// couldn't be processed, in which case the whole message is retried, and the channel is empty if
+	// the notification couldn't be routed.
+	Notification *Notification `json:"notification,omitempty"`
+	Channel      string        `json:"channel,omitempty"`
+	// How many times the delivery has been retried from the retry topic
+	Retries  int       `json:"retries"`
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failedAt"`
+	// When the retry topic should try again
+	RetryAt time.Time `json:"retryAt"`
+}
+
+// Sends the notification, retrying with exponential backoff up to deliveryAttempts times or until
+// ctx is done.
+func deliver(ctx context.Context, notifier Notifier, notification *Notification) error {
+	var err error
+	for attempt := 0; attempt < deliveryAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(deliveryBackoff << (attempt - 1)):
+			}
+		}
+		err = notifier.Notify(ctx, notification)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Hands a failed delivery to the retry topic, or to the dead-letter topic once it's out of retries
+// or when retrying can't help. Publishing is retried with backoff until the topic takes it, so this
+// only returns an error once ctx is done, in which case the message mustn't be marked so that it's
+// consumed again.
+func (h consumerGroupHandler) fail(ctx context.Context, delivery *FailedDelivery, reason error, permanent bool) error {
+	now := time.Now().UTC()
+	delivery.Reason = reason.Error()
+	delivery.FailedAt = now
+
+	topic := retryTier(h.retryTopic, delivery.Retries)
+	if permanent || delivery.Retries >= maxRetries {
+		topic = h.deadLetterTopic
+		fmt.Printf("Dead-lettering delivery for %v message %v: %v\n", delivery.Topic, delivery.Key, reason)
+	} else {
+		delivery.RetryAt = now.Add(retryDelay(delivery.Retries))
+		fmt.Printf("Retrying delivery for %v message %v at %v: %v\n", delivery.Topic, delivery.Key, delivery.RetryAt, reason)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := publishDelivery(h.producer, topic, delivery)
+		if err == nil {
+			return nil
+		}
+
+		delay := publishDelay(attempt)
+		fmt.Printf("Error publishing delivery to %v, trying again in %v: %v\n", topic, delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Consumes a message from a retry topic, trying the delivery again. ConsumeClaim holds the message
+// back until it's due.
+func (h consumerGroupHandler) handleRetry(ctx context.Context, message *sarama.ConsumerMessage) error {
+	var delivery FailedDelivery
+	err := json.Unmarshal(message.Value, &delivery)
+	if err != nil {
+		// The message itself is dead-lettered, so it can be inspected and replayed once it's fixed
+		return h.fail(ctx, newDelivery(message, 0), fmt.Errorf("decoding retry message: %w", err), true)
+	}
+
+	original := &sarama.ConsumerMessage{
+		Topic:     delivery.Topic,
+		Partition: delivery.Partition,
+		Offset:    delivery.Offset,
+		Key:       []byte(delivery.Key),
+		Value:     []byte(delivery.Value),
+	}
+
+	// Messages that couldn't be processed are processed again from the start, and notifications
+	// that couldn't be routed are routed again
+	if delivery.Notification == nil {
+		return h.handleEvent(ctx, original, delivery.Retries+1)
+	}
+	if delivery.Channel == "" {
+		return h.notify(ctx, original, delivery.Retries+1, delivery.Notification)
+	}
+
+	// Notifications that failed on a channel are sent straight over it, even if they were meant
+	// for a digest
+	delivery.Retries++
+	notifier := h.routes.Notifier(delivery.Channel)
+	if notifier == nil {
+		return h.fail(ctx, &delivery, fmt.Errorf("channel %q is no longer configured", delivery.Channel), true)
+	}
+	err = h.deliverOnce(original, delivery.Channel, delivery.Notification, func() error {
+		return deliver(ctx, notifier, delivery.Notification)
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return h.fail(ctx, &delivery, err, false)
+	}
+	return nil
+}
+
+// Returns when a message from a retry topic is due. Messages that can't be decoded are due straight
+// away, so they can be dead-lettered.
+func retryAt(message *sarama.ConsumerMessage) time.Time {
+	var delivery FailedDelivery
+	json.Unmarshal(message.Value, &delivery)
+	return delivery.RetryAt
+}
+
+// Returns the retry topic for deliveries that have been retried the given number of times. Each
+// retry delay has its own topic, named after the base retry topic and the delay in minutes, e.g.
+// "notification-retry-4m".
+func retryTier(retryTopic string, retries int) string {
+	return fmt.Sprintf("%v-%dm", retryTopic, retryDelay(retries)/time.Minute)
+}
+
+// Returns every retry topic: the base retry topic, which replayed dead letters are published to, and
+// the topic for each retry delay.
+func retryTopics(retryTopic string) []string {
+	topics := []string{retryTopic}
+	for retries := 0; retries < maxRetries; retries++ {
+		topics = append(topics, retryTier(retryTopic, retries))
+	}
+	return topics
+}
+
+// Returns the topics failed deliveries are published to: every retry topic and the dead-letter topic.
+func DeliveryTopics(retryTopic string, deadLetterTopic string) []string {
+	return append(retryTopics(retryTopic), deadLetterTopic)
+}
+
+// Returns how long to wait before retrying a delivery that has been retried the given number of times.
+func retryDelay(retries int) time.Duration {
+	delay := retryBackoff << retries
+	if retries > 16 || delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
+
+// Returns how long to wait before publishing a failed delivery again after the given number of
+// failed attempts.
+func publishDelay(attempts int) time.Duration {
+	delay := publishBackoff << attempts
+	if attempts > 16 || delay > maxPublishBackoff {
+		return maxPublishBackoff
+	}
+	return delay
+}
+
+func newDelivery(message *sarama.ConsumerMessage, retries int) *FailedDelivery {
+	return &FailedDelivery{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       string(message.Key),
+		Value:     string(message.Value),
+		Retries:   retries,
+	}
+}
+
+func publishDelivery(producer sarama.SyncProducer, topic string, delivery *FailedDelivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, _, err = producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(delivery.Key),
+		Value: sarama.ByteEncoder(value),
+	})
+	return err
+}
@@ -0,0 +1,199 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+func TestRetryTopics(t *testing.T) {
+	expected := []string{
+		"notification-retry",
+		"notification-retry-1m",
+		"notification-retry-2m",
+		"notification-retry-4m",
+		"notification-retry-8m",
+		"notification-retry-16m",
+	}
+	topics := retryTopics("notification-retry")
+	if !slices.Equal(topics, expected) {
+		t.Errorf("expected retry topics %v, got %v", expected, topics)
+	}
+
+	// Every delivery that can still be retried has a tier that's consumed
+	for retries := 0; retries < maxRetries; retries++ {
+		if !slices.Contains(topics, retryTier("notification-retry", retries)) {
+			t.Errorf("tier for %v retries %v isn't consumed", retries, retryTier("notification-retry", retries))
+		}
+	}
+}
+
+func TestUnreadableRetryMessageDeadLettered(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	handler := consumerGroupHandler{
+		producer:        producer,
+		retryTopic:      "notification-retry",
+		deadLetterTopic: "notification-dead-letter",
+	}
+
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		if message.Topic != "notification-dead-letter" {
+			return fmt.Errorf("expected the message to be dead-lettered, got topic %v", message.Topic)
+		}
+		value, err := message.Value.Encode()
+		if err != nil {
+			return err
+		}
+		var delivery FailedDelivery
+		err = json.Unmarshal(value, &delivery)
+		if err != nil {
+			return err
+		}
+		if delivery.Topic != "notification-retry-1m" || delivery.Value != "not json" || !strings.HasPrefix(delivery.Reason, "decoding retry message") {
+			return fmt.Errorf("expected the unreadable message and why it failed, got %+v", delivery)
+		}
+		return nil
+	})
+
+	err := handler.handle(context.Background(), &sarama.ConsumerMessage{
+		Topic: "notification-retry-1m",
+		Key:   []byte("offer-42"),
+		Value: []byte("not json"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliveryTopics(t *testing.T) {
+	topics := DeliveryTopics("notification-retry", "notification-dead-letter")
+	expected := append(retryTopics("notification-retry"), "notification-dead-letter")
+	if !slices.Equal(topics, expected) {
+		t.Errorf("expected delivery topics %v, got %v", expected, topics)
+	}
+}
+
+// Records the partitions paused and resumed
+type fakePauser struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *fakePauser) Pause(partitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, fmt.Sprint("pause ", partitions))
+}
+
+func (p *fakePauser) Resume(partitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, fmt.Sprint("resume ", partitions))
+}
+
+func TestRetryHeldBackUntilDue(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	defer producer.Close()
+	pauser := &fakePauser{}
+	handler := consumerGroupHandler{
+		registry:        NewRegistry(),
+		producer:        producer,
+		retryTopic:      "notification-retry",
+		deadLetterTopic: "notification-dead-letter",
+		workers:         1,
+		pauser:          pauser,
+	}
+
+	// The retried message's topic has no handler, so it's dead-lettered as soon as it's retried
+	retryAt := time.Now().Add(200 * time.Millisecond)
+	value, err := json.Marshal(FailedDelivery{Topic: "unknown", Key: "offer-42", Value: "{}", RetryAt: retryAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var retried time.Time
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(message *sarama.ProducerMessage) error {
+		retried = time.Now()
+		return nil
+	})
+
+	kafka := mocks.NewConsumer(t, nil)
+	defer kafka.Close()
+	kafka.ExpectConsumePartition("notification-retry-1m", 0, sarama.OffsetOldest).YieldMessage(&sarama.ConsumerMessage{
+		Key:   []byte("offer-42"),
+		Value: value,
+	})
+	partition, err := kafka.ConsumePartition("notification-retry-1m", 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition.AsyncClose()
+
+	session := &fakeSession{ctx: context.Background()}
+	err = handler.ConsumeClaim(session, &fakeClaim{PartitionConsumer: partition, topic: "notification-retry-1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if retried.Before(retryAt) {
+		t.Errorf("expected the message to be retried at %v, got %v", retryAt, retried)
+	}
+	expected := []string{"pause map[notification-retry-1m:[0]]", "resume map[notification-retry-1m:[0]]"}
+	if !slices.Equal(pauser.calls, expected) {
+		t.Errorf("expected the partition to be paused while the message waited, got %v", pauser.calls)
+	}
+	if marked := session.markedOffsets(); !slices.Equal(marked, []int64{1}) {
+		t.Errorf("expected the message to be marked, got %v", marked)
+	}
+}
+
+func TestRetryWaitEndsWithSession(t *testing.T) {
+	pauser := &fakePauser{}
+	handler := consumerGroupHandler{
+		retryTopic: "notification-retry",
+		workers:    1,
+		pauser:     pauser,
+	}
+
+	value, err := json.Marshal(FailedDelivery{Topic: offerTopic, Key: "offer-42", Value: "{}", RetryAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kafka := mocks.NewConsumer(t, nil)
+	defer kafka.Close()
+	kafka.ExpectConsumePartition("notification-retry-1m", 0, sarama.OffsetOldest).YieldMessage(&sarama.ConsumerMessage{
+		Key:   []byte("offer-42"),
+		Value: value,
+	})
+	partition, err := kafka.ConsumePartition("notification-retry-1m", 0, sarama.OffsetOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer partition.AsyncClose()
+
+	// Ending the session while the message waits returns without handling or marking it
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	err = handler.ConsumeClaim(session, &fakeClaim{PartitionConsumer: partition, topic: "notification-retry-1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if marked := session.markedOffsets(); len(marked) != 0 {
+		t.Errorf("expected nothing to be marked, got %v", marked)
+	}
+	pauser.mu.Lock()
+	defer pauser.mu.Unlock()
+	if len(pauser.calls) != 2 || !strings.HasPrefix(pauser.calls[1], "resume") {
+		t.Errorf("expected the partition to be resumed when the session ended, got %v", pauser.calls)
+	}
+}
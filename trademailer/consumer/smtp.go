@@ -0,0 +1,221 @@
+package consumer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sync"
+	"time"
+
+	"github.com/robertjshirts/events"
+	"golang.org/x/time/rate"
+
+	"github.com/robertjshirts/trademailer/email"
+)
+
+// TLS modes for the connection to the SMTP server
+const (
+	// Connect in plaintext and upgrade with STARTTLS, failing if the server doesn't support it
+	StartTLS = "starttls"
+	// Connect over TLS from the start (usually port 465)
+	ImplicitTLS = "tls"
+	// Never use TLS. Only meant for local test servers.
+	NoTLS = "none"
+)
+
+// The service account that trademailer sends all of its email as
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	From     string
+	Username string
+	Password string
+	TLSMode  string
+	// The most emails per second sent to the host, shared by all workers. Zero means no limit.
+	RateLimit float64
+	// How many emails can be sent at once before the rate limit applies
+	Burst int
+	// How long sending one email may take, from dialing the host to QUIT. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Rate limiters for each SMTP host, shared by every notifier that sends to the host
+var smtpLimiters = struct {
+	sync.Mutex
+	hosts map[string]*rate.Limiter
+}{hosts: map[string]*rate.Limiter{}}
+
+// Returns the rate limiter for the configured host, or nil if sends to it aren't limited.
+func hostLimiter(config SMTPConfig) *rate.Limiter {
+	if config.RateLimit <= 0 {
+		return nil
+	}
+
+	smtpLimiters.Lock()
+	defer smtpLimiters.Unlock()
+
+	limiter, ok := smtpLimiters.hosts[config.Host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(config.RateLimit), max(config.Burst, 1))
+		smtpLimiters.hosts[config.Host] = limiter
+	}
+	return limiter
+}
+
+// The data email templates are rendered with
+type EmailData struct {
+	// The user the email is addressed to
+	To events.User
+	// The offer the email is about. Nil for user emails.
+	Offer *events.Offer
+}
+
+// Renders notifications with the email templates and sends them over SMTP
+type SMTPNotifier struct {
+	config    SMTPConfig
+	templates *email.Templates
+	limiter   *rate.Limiter
+}
+
+func NewSMTPNotifier(config SMTPConfig, templates *email.Templates) (*SMTPNotifier, error) {
+	if templates == nil {
+		return nil, fmt.Errorf("no email templates provided")
+	}
+	return &SMTPNotifier{
+		config:    config,
+		templates: templates,
+		limiter:   hostLimiter(config),
+	}, nil
+}
+
+// Renders the notification's template and sends it to the recipient. Notifications without a
+// template don't send anything.
+func (n *SMTPNotifier) Notify(ctx context.Context, notification *Notification) error {
+	if !n.templates.Has(notification.Name) {
+		fmt.Printf("No email template %v, skipping\n", notification.Name)
+		return nil
+	}
+
+	return n.Send(ctx, notification.Name, notification.To, EmailData{
+		To:    notification.To,
+		Offer: notification.Event.Offer,
+	})
+}
+
+// Renders the named template with data and sends it to the user, giving up when ctx is done.
+func (n *SMTPNotifier) Send(ctx context.Context, template string, to events.User, data interface{}) error {
+	subject, text, html, err := n.templates.Render(template, data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := (&email.Message{
+		From:    mail.Address{Address: n.config.From},
+		To:      mail.Address{Name: to.Name, Address: to.Email},
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	}).Bytes()
+	if err != nil {
+		return err
+	}
+
+	if n.limiter != nil {
+		err = n.limiter.Wait(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sendMail(ctx, n.config, []string{to.Email}, msg)
+}
+
+// Sends the message from the configured sender to the recipients. Authenticates with the configured
+// username and password if there is a username. The whole exchange has to finish within the
+// configured timeout, and is cut off when ctx is done.
+func sendMail(ctx context.Context, config SMTPConfig, to []string, msg []byte) error {
+	address := net.JoinHostPort(config.Host, config.Port)
+	tlsConfig := &tls.Config{ServerName: config.Host}
+
+	if config.TLSMode != ImplicitTLS && config.TLSMode != StartTLS && config.TLSMode != NoTLS {
+		return fmt.Errorf("unknown SMTP TLS mode %q", config.TLSMode)
+	}
+
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Every read and write on the connection fails once the deadline passes or ctx is done, so a
+	// server that stops responding can't hold up the send
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if config.TLSMode == ImplicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if config.TLSMode == StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %v does not support STARTTLS", address)
+		}
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", config.Username, config.Password, config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(config.From)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		err = client.Rcpt(recipient)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
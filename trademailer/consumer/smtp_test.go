@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// What a recordingServer was sent over one connection
+type smtpSession struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// Starts a plaintext SMTP server that accepts everything and reports each session on the channel once
+// the client quits, returning its host and port.
+func recordingServer(t *testing.T) (string, string, <-chan smtpSession) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(textproto.NewConn(conn), sessions)
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port, sessions
+}
+
+func serveSMTP(conn *textproto.Conn, sessions chan<- smtpSession) {
+	defer conn.Close()
+	var session smtpSession
+	conn.PrintfLine("220 localhost ready")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250-localhost")
+			conn.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			session.auth = arg
+			conn.PrintfLine("235 authenticated")
+		case "MAIL":
+			session.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			conn.PrintfLine("250 ok")
+		case "RCPT":
+			session.to = append(session.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			conn.PrintfLine("250 ok")
+		case "DATA":
+			conn.PrintfLine("354 go ahead")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			session.data = string(data)
+			conn.PrintfLine("250 ok")
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			sessions <- session
+			return
+		default:
+			conn.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		tlsMode  string
+		// Whether the message should be delivered, and whether with authentication
+		sent bool
+		auth bool
+	}{
+		{"service account", "", NoTLS, true, false},
+		{"authenticated service account", "gametrader", NoTLS, true, true},
+		// The server doesn't advertise STARTTLS, so nothing may be sent in plaintext
+		{"starttls unsupported", "", StartTLS, false, false},
+		{"unknown tls mode", "", "ssl", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			host, port, sessions := recordingServer(t)
+			config := SMTPConfig{Host: host, Port: port, From: "gametrader@localhost", Username: test.username, Password: "secret", TLSMode: test.tlsMode}
+
+			err := sendMail(context.Background(), config, []string{"alice@example.com"}, []byte("Subject: Hi\r\n\r\nhello\r\n"))
+			if !test.sent {
+				if err == nil {
+					t.Fatal("expected the send to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session := <-sessions
+			if session.from != config.From {
+				t.Errorf("expected the message to be sent from %v, got %v", config.From, session.from)
+			}
+			if len(session.to) != 1 || session.to[0] != "alice@example.com" {
+				t.Errorf("expected the message to be sent to alice@example.com, got %v", session.to)
+			}
+			if !strings.Contains(session.data, "hello") {
+				t.Errorf("expected the message body to be sent, got %q", session.data)
+			}
+			if (session.auth != "") != test.auth {
+				t.Errorf("expected authentication to be %v, got %q", test.auth, session.auth)
+			}
+		})
+	}
+}
+
+// Starts a server that accepts connections and never responds, returning its host and port.
+func hungServer(t *testing.T) (string, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+func TestSendMailTimeout(t *testing.T) {
+	host, port := hungServer(t)
+	config := SMTPConfig{Host: host, Port: port, From: "gametrader@localhost", TLSMode: NoTLS, Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	err := sendMail(context.Background(), config, []string{"alice@example.com"}, []byte("hello"))
+	if err == nil {
+		t.Fatal("expected the send to a hung server to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the send to give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestSendMailCancelled(t *testing.T) {
+	host, port := hungServer(t)
+	config := SMTPConfig{Host: host, Port: port, From: "gametrader@localhost", TLSMode: NoTLS}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := sendMail(ctx, config, []string{"alice@example.com"}, []byte("hello"))
+	if err == nil {
+		t.Fatal("expected the cancelled send to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the send to give up once cancelled, took %v", elapsed)
+	}
+}
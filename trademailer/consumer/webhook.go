@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers sent with every webhook. The signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed
+// with the shared secret, so receivers can reject forged and replayed requests.
+const (
+	SignatureHeader = "X-Gametrader-Signature"
+	TimestampHeader = "X-Gametrader-Timestamp"
+)
+
+// POSTs notifications as JSON to a URL, signed with a shared secret
+type WebhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, secret string, timeout time.Duration) (*WebhookNotifier, error) {
+	if url == "" {
+		return nil, fmt.Errorf("no webhook URL provided")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("no webhook secret provided")
+	}
+	return &WebhookNotifier{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %v responded %v", w.url, resp.Status)
+	}
+	return nil
+}
+
+// Returns the hex HMAC-SHA256 signature of a webhook body sent at the given unix timestamp.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,109 @@
+package consumer
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Messages queued per worker before dispatching blocks
+const workerQueueSize = 16
+
+// Handles one claimed partition's messages on a fixed number of workers. Messages with the same key
+// always go to the same worker and each worker handles its messages in order, so events for the same
+// offer or user are handled in the order they were published while a slow send only holds up the
+// keys that share its worker.
+type claimPool struct {
+	handle  func(ctx context.Context, message *sarama.ConsumerMessage) error
+	session sarama.ConsumerGroupSession
+	queues  []chan *sarama.ConsumerMessage
+	wg      sync.WaitGroup
+	offsets *offsetTracker
+}
+
+func newClaimPool(handle func(ctx context.Context, message *sarama.ConsumerMessage) error, session sarama.ConsumerGroupSession, workers int) *claimPool {
+	p := &claimPool{
+		handle:  handle,
+		session: session,
+		queues:  make([]chan *sarama.ConsumerMessage, workers),
+		offsets: &offsetTracker{session: session, done: map[int64]bool{}},
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *sarama.ConsumerMessage, workerQueueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// Queues the message on the worker for its key. Blocks while that worker's queue is full, unless the
+// session ends, in which case the message is dropped without being marked.
+func (p *claimPool) dispatch(message *sarama.ConsumerMessage) {
+	p.offsets.add(message)
+
+	hash := fnv.New32a()
+	hash.Write(message.Key)
+	queue := p.queues[hash.Sum32()%uint32(len(p.queues))]
+
+	select {
+	case queue <- message:
+	case <-p.session.Context().Done():
+	}
+}
+
+func (p *claimPool) work(queue <-chan *sarama.ConsumerMessage) {
+	defer p.wg.Done()
+	for message := range queue {
+		// Once the session has ended, queued messages are left unmarked to be consumed again
+		if p.session.Context().Err() != nil {
+			continue
+		}
+
+		// Handling only fails once the session has ended, as failed deliveries are published until
+		// the retry or dead-letter topic takes them. The message is left unmarked, and so is every
+		// message after it in the partition.
+		err := p.handle(p.session.Context(), message)
+		if err != nil {
+			continue
+		}
+		p.offsets.handled(message)
+	}
+}
+
+// Waits for the workers to finish the messages they're handling.
+func (p *claimPool) stop() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// Marks messages in offset order as they're handled, so that a message is only marked once every
+// message before it in the partition has been handled too.
+type offsetTracker struct {
+	mu      sync.Mutex
+	session sarama.ConsumerGroupSession
+	// Dispatched messages that haven't been marked, in offset order
+	pending []*sarama.ConsumerMessage
+	done    map[int64]bool
+}
+
+func (t *offsetTracker) add(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, message)
+}
+
+func (t *offsetTracker) handled(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[message.Offset] = true
+	for len(t.pending) > 0 && t.done[t.pending[0].Offset] {
+		delete(t.done, t.pending[0].Offset)
+		t.session.MarkMessage(t.pending[0], "")
+		t.pending = t.pending[1:]
+	}
+}
@@ -0,0 +1,162 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.marked)
+}
+
+// Returns a key for each worker of a pool with the given number of workers, so that each message
+// in a test can be sent to a worker of its own.
+func workerKeys(workers int) []string {
+	keys := make([]string, workers)
+	found := 0
+	for i := 0; found < workers; i++ {
+		key := fmt.Sprint(i)
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		worker := hash.Sum32() % uint32(workers)
+		if keys[worker] == "" {
+			keys[worker] = key
+			found++
+		}
+	}
+	return keys
+}
+
+// Waits until the tracker has recorded the message at offset as handled, whether or not it has
+// been marked.
+func waitHandled(t *testing.T, tracker *offsetTracker, offset int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		tracker.mu.Lock()
+		handled := tracker.done[offset] || !slices.ContainsFunc(tracker.pending, func(m *sarama.ConsumerMessage) bool {
+			return m.Offset == offset
+		})
+		tracker.mu.Unlock()
+		if handled {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("message at offset %v was never handled", offset)
+}
+
+func TestOffsetTrackerMarksInOrder(t *testing.T) {
+	session := &fakeSession{ctx: context.Background()}
+	tracker := &offsetTracker{session: session, done: map[int64]bool{}}
+
+	messages := []*sarama.ConsumerMessage{}
+	for offset := int64(0); offset < 5; offset++ {
+		message := &sarama.ConsumerMessage{Topic: offerTopic, Offset: offset}
+		messages = append(messages, message)
+		tracker.add(message)
+	}
+
+	// Marking a message commits the offset after it
+	steps := []struct {
+		handled int64
+		marked  []int64
+	}{
+		{2, []int64{}},
+		{0, []int64{1}},
+		{1, []int64{1, 2, 3}},
+		{4, []int64{1, 2, 3}},
+		{3, []int64{1, 2, 3, 4, 5}},
+	}
+	for _, step := range steps {
+		tracker.handled(messages[step.handled])
+		marked := session.markedOffsets()
+		if marked == nil {
+			marked = []int64{}
+		}
+		if !slices.Equal(marked, step.marked) {
+			t.Fatalf("after handling offset %v, expected offsets %v to be marked, got %v", step.handled, step.marked, marked)
+		}
+	}
+}
+
+func TestClaimPoolMarksOutOfOrderMessagesInOrder(t *testing.T) {
+	keys := workerKeys(2)
+	release := map[int64]chan struct{}{0: make(chan struct{}), 1: make(chan struct{})}
+
+	session := &fakeSession{ctx: context.Background()}
+	pool := newClaimPool(func(ctx context.Context, message *sarama.ConsumerMessage) error {
+		<-release[message.Offset]
+		return nil
+	}, session, 2)
+
+	for offset := int64(0); offset < 2; offset++ {
+		pool.dispatch(&sarama.ConsumerMessage{Topic: offerTopic, Key: []byte(keys[offset]), Offset: offset})
+	}
+
+	// The second message finishes first, but can't be marked until the first is done
+	close(release[1])
+	waitHandled(t, pool.offsets, 1)
+	if marked := session.markedOffsets(); len(marked) != 0 {
+		t.Fatalf("expected nothing to be marked before the first message is handled, got %v", marked)
+	}
+
+	close(release[0])
+	pool.stop()
+	if marked := session.markedOffsets(); !slices.Equal(marked, []int64{1, 2}) {
+		t.Errorf("expected offsets [1 2] to be marked, got %v", marked)
+	}
+}
+
+func TestClaimPoolStopsWhenHandlingFails(t *testing.T) {
+	keys := workerKeys(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+
+	var mu sync.Mutex
+	handled := []int64{}
+	started := make(chan struct{})
+	pool := newClaimPool(func(ctx context.Context, message *sarama.ConsumerMessage) error {
+		mu.Lock()
+		handled = append(handled, message.Offset)
+		mu.Unlock()
+
+		// The first message can't be handled before the session ends
+		if message.Offset == 0 {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}, session, 2)
+
+	// Offsets 0 and 2 go to one worker and offset 1 to the other
+	pool.dispatch(&sarama.ConsumerMessage{Topic: offerTopic, Key: []byte(keys[0]), Offset: 0})
+	pool.dispatch(&sarama.ConsumerMessage{Topic: offerTopic, Key: []byte(keys[1]), Offset: 1})
+	pool.dispatch(&sarama.ConsumerMessage{Topic: offerTopic, Key: []byte(keys[0]), Offset: 2})
+	<-started
+	waitHandled(t, pool.offsets, 1)
+
+	cancel()
+	pool.stop()
+
+	// Nothing after the failed message is marked, and the message queued behind it isn't handled
+	if marked := session.markedOffsets(); len(marked) != 0 {
+		t.Errorf("expected nothing to be marked, got %v", marked)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if slices.Contains(handled, 2) {
+		t.Errorf("expected the message queued behind the failed one not to be handled, handled %v", handled)
+	}
+}
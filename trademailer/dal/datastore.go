@@ -3,13 +3,29 @@ package dal
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
 )
 
 type SQLDatastore struct {
-	db *sql.DB
+	conn *sql.DB
+	// Either the connection pool or the transaction the datastore was handed to in WithTx
+	db querier
+}
+
+// Satisfied by both *sql.DB and *sql.Tx, so the same queries can run inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// The datastore operations available inside a transaction started by WithTx.
+type TxStore interface {
+	DeleteDigestEntries(ids []int) error
+	CompleteDelivery(eventId string, userId int, channel string) error
 }
 
 func Init(host string, port string, user string, password string, protocol string, dbName string) (*SQLDatastore, error) {
@@ -23,13 +39,14 @@ func Init(host string, port string, user string, password string, protocol strin
 	}
 	fmt.Printf("Connecting to database with %s\n", cfg.FormatDSN())
 	var err error
-	d.db, err = sql.Open("mysql", cfg.FormatDSN())
+	d.conn, err = sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
+	d.db = d.conn
 	connected := false
 	for attempts := 0; attempts < 5; attempts++ {
-		if err := d.db.Ping(); err != nil {
+		if err := d.conn.Ping(); err != nil {
 			fmt.Println("Failed to connect to the database. Retrying in 10 seconds...")
 			time.Sleep(10 * time.Second)
 		} else {
@@ -44,23 +61,180 @@ func Init(host string, port string, user string, password string, protocol strin
 }
 
 func (d *SQLDatastore) Close() error {
-	return d.db.Close()
+	return d.conn.Close()
+}
+
+// Runs fn inside a single transaction, committing if it returns nil and rolling back otherwise.
+func (d *SQLDatastore) WithTx(fn func(tx TxStore) error) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// Rolling back after a successful commit is a no-op
+	defer tx.Rollback()
+
+	err = fn(&SQLDatastore{conn: d.conn, db: tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (d *SQLDatastore) GetOfferDetails(offerId int) (*Offer, error) {
 	var offer Offer
-	err := d.db.QueryRow("SELECT `offererUserId`, `recipientUserId` FROM `offers` WHERE `offerId` = ?", offerId).Scan(&offer.OffererUserId, &offer.RecipientUserId)
+	err := d.db.QueryRow("SELECT `offererUserId`, `recipientUserId`, `status` FROM `offers` WHERE `offerId` = ?", offerId).Scan(&offer.OffererUserId, &offer.RecipientUserId, &offer.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query("SELECT `gameId`, `side` FROM `offer_items` WHERE `offerId` = ? ORDER BY `gameId`", offerId)
 	if err != nil {
 		return nil, err
 	}
-	return &offer, nil
+	defer rows.Close()
+
+	offer.OffererGameIds = []int{}
+	offer.RecipientGameIds = []int{}
+	for rows.Next() {
+		var gameId int
+		var side string
+		err := rows.Scan(&gameId, &side)
+		if err != nil {
+			return nil, err
+		}
+		if side == "offerer" {
+			offer.OffererGameIds = append(offer.OffererGameIds, gameId)
+		} else {
+			offer.RecipientGameIds = append(offer.RecipientGameIds, gameId)
+		}
+	}
+	return &offer, rows.Err()
 }
 
 func (d *SQLDatastore) GetUserDetails(userId int) (*User, error) {
 	var user User
-	err := d.db.QueryRow("SELECT `email`, `name`, `password` FROM `users` WHERE `userId` = ?", userId).Scan(&user.Email, &user.Name, &user.Password)
+	err := d.db.QueryRow("SELECT `email`, `name` FROM `users` WHERE `userId` = ?", userId).Scan(&user.Email, &user.Name)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
+
+func (d *SQLDatastore) GetGameDetails(gameId int) (*Game, error) {
+	var game Game
+	err := d.db.QueryRow("SELECT `gameId`, `name`, `system`, `condition` FROM `games` WHERE `gameId` = ?", gameId).Scan(&game.GameId, &game.Name, &game.System, &game.Condition)
+	if err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// Returns sql.ErrNoRows if the user has never saved their preferences.
+func (d *SQLDatastore) GetPreferences(userId int) (*Preferences, error) {
+	var preferences Preferences
+	var channels, mutedEvents string
+	err := d.db.QueryRow("SELECT `channels`, `mutedEvents`, `delivery` FROM `notification_preferences` WHERE `userId` = ?", userId).Scan(&channels, &mutedEvents, &preferences.Delivery)
+	if err != nil {
+		return nil, err
+	}
+	preferences.Channels = splitSet(channels)
+	preferences.MutedEvents = splitSet(mutedEvents)
+	return &preferences, nil
+}
+
+// Splits the value of a MySQL SET column into its members.
+func splitSet(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func (d *SQLDatastore) CreateDigestEntry(entry *DigestEntry) error {
+	_, err := d.db.Exec("INSERT INTO `digest_entries` (`userId`, `delivery`, `notification`, `createdAt`) VALUES (?, ?, ?, ?)", entry.UserId, entry.Delivery, entry.Notification, entry.CreatedAt)
+	return err
+}
+
+// Returns the users with entries for the delivery mode that were buffered before the given time.
+func (d *SQLDatastore) GetDigestRecipients(delivery string, before time.Time) ([]int, error) {
+	rows, err := d.db.Query("SELECT DISTINCT `userId` FROM `digest_entries` WHERE `delivery` = ? AND `createdAt` < ?", delivery, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIds := []int{}
+	for rows.Next() {
+		var userId int
+		err := rows.Scan(&userId)
+		if err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
+
+// Returns the user's entries for the delivery mode that were buffered before the given time, oldest
+// first.
+func (d *SQLDatastore) GetDigestEntries(userId int, delivery string, before time.Time) ([]DigestEntry, error) {
+	rows, err := d.db.Query("SELECT `digestEntryId`, `userId`, `delivery`, `notification` FROM `digest_entries` "+
+		"WHERE `userId` = ? AND `delivery` = ? AND `createdAt` < ? ORDER BY `digestEntryId`", userId, delivery, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []DigestEntry{}
+	for rows.Next() {
+		var entry DigestEntry
+		err := rows.Scan(&entry.DigestEntryId, &entry.UserId, &entry.Delivery, &entry.Notification)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (d *SQLDatastore) DeleteDigestEntries(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	_, err := d.db.Exec("DELETE FROM `digest_entries` WHERE `digestEntryId` IN ("+placeholders+")", args...)
+	return err
+}
+
+// Claims the delivery of an event to a user over a channel, so it's only sent once. Returns false if
+// it has already been sent, or if another claim on it is younger than the lease and may still be
+// sending.
+func (d *SQLDatastore) ClaimDelivery(eventId string, userId int, channel string, lease time.Duration) (bool, error) {
+	result, err := d.db.Exec("INSERT INTO `deliveries` (`eventId`, `userId`, `channel`, `status`, `claimedAt`) VALUES (?, ?, ?, 'claimed', NOW()) "+
+		"ON DUPLICATE KEY UPDATE `claimedAt` = IF(`status` = 'claimed' AND `claimedAt` < NOW() - INTERVAL ? SECOND, NOW(), `claimedAt`)",
+		eventId, userId, channel, int(lease.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	// 1 for a new claim, 2 for a taken over claim and 0 if the existing row was left alone
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (d *SQLDatastore) CompleteDelivery(eventId string, userId int, channel string) error {
+	_, err := d.db.Exec("UPDATE `deliveries` SET `status` = 'sent', `sentAt` = NOW() WHERE `eventId` = ? AND `userId` = ? AND `channel` = ?", eventId, userId, channel)
+	return err
+}
+
+// Gives up a claim on a delivery that failed, so that a retry can claim it again.
+func (d *SQLDatastore) ReleaseDelivery(eventId string, userId int, channel string) error {
+	_, err := d.db.Exec("DELETE FROM `deliveries` WHERE `eventId` = ? AND `userId` = ? AND `channel` = ? AND `status` = 'claimed'", eventId, userId, channel)
+	return err
+}
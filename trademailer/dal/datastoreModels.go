@@ -1,5 +1,7 @@
 package dal
 
+import "time"
+
 type GameCondition string
 
 const (
@@ -16,22 +18,55 @@ const (
 	Accepted  StatusCondition = "accepted"
 	Rejected  StatusCondition = "rejected"
 	Cancelled StatusCondition = "cancelled"
+	Countered StatusCondition = "countered"
+	Expired   StatusCondition = "expired"
+)
+
+// Notification delivery modes
+const (
+	Immediate = "immediate"
+	Daily     = "daily"
+	Weekly    = "weekly"
 )
 
 type Game struct {
-	GameId     int
-	Name       string
-	System     string
-	Conidition GameCondition
+	GameId    int
+	Name      string
+	System    string
+	Condition GameCondition
 }
 
 type User struct {
-	Email    string
-	Name     string
-	Password string
+	Email string
+	Name  string
+}
+
+// A user's notification preferences
+type Preferences struct {
+	// The channels the user can be notified over
+	Channels []string
+	// The events, as "<kind>.<type>", the user doesn't want to be notified about
+	MutedEvents []string
+	// immediate, daily or weekly
+	Delivery string
 }
 
 type Offer struct {
 	OffererUserId   int
 	RecipientUserId int
+	// The games each user gives up in the trade
+	OffererGameIds   []int
+	RecipientGameIds []int
+	Status           StatusCondition
+}
+
+// A notification held back for a user's next digest
+type DigestEntry struct {
+	DigestEntryId int
+	UserId        int
+	// daily or weekly
+	Delivery string
+	// The JSON encoded notification
+	Notification string
+	CreatedAt    time.Time
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/robertjshirts/trademailer/consumer"
+)
+
+const deadLettersUsage = `Usage:
+  trademailer deadletters list
+  trademailer deadletters replay <partition:offset>... | all`
+
+// Lists or replays the messages in the dead-letter topic. Returns the exit code.
+func runDeadLetters(args []string) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "replay") {
+		fmt.Fprintln(os.Stderr, deadLettersUsage)
+		return 2
+	}
+
+	kafkaConfig := ReadSaramaConfig("config/kafka.config")
+	brokers := strings.Split(kafkaConfig["brokers"], ",")
+
+	deadLetters, err := consumer.ListDeadLetters(brokers, kafkaConfig["deadLetterTopic"])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading dead letters: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tFAILED AT\tTOPIC\tKEY\tNOTIFICATION\tCHANNEL\tREASON")
+		for _, deadLetter := range deadLetters {
+			delivery := deadLetter.Delivery
+			notification := "-"
+			if delivery.Notification != nil {
+				notification = delivery.Notification.Name
+			}
+			channel := delivery.Channel
+			if channel == "" {
+				channel = "-"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", deadLetter.Id(), delivery.FailedAt.Format("2006-01-02 15:04:05"), delivery.Topic, delivery.Key, notification, channel, delivery.Reason)
+		}
+		w.Flush()
+		return 0
+	case "replay":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, deadLettersUsage)
+			return 2
+		}
+
+		replay := deadLetters
+		if args[1] != "all" {
+			replay = []consumer.DeadLetter{}
+			for _, id := range args[1:] {
+				found := false
+				for _, deadLetter := range deadLetters {
+					if deadLetter.Id() == id {
+						replay = append(replay, deadLetter)
+						found = true
+					}
+				}
+				if !found {
+					fmt.Fprintf(os.Stderr, "No dead letter %v\n", id)
+					return 1
+				}
+			}
+		}
+
+		err := consumer.ReplayDeadLetters(brokers, kafkaConfig["retryTopic"], replay)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error replaying dead letters: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Replayed %v dead letters\n", len(replay))
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// A rendered email with plain text and HTML alternatives.
+type Message struct {
+	From    mail.Address
+	To      mail.Address
+	Subject string
+	Text    string
+	HTML    string
+	Date    time.Time
+}
+
+// Encodes the message as a multipart/alternative MIME message ready to hand to an SMTP server.
+// Names or addresses containing line breaks are rejected, so they can't add headers of their own.
+func (m *Message) Bytes() ([]byte, error) {
+	for _, address := range []mail.Address{m.From, m.To} {
+		if strings.ContainsAny(address.Name, "\r\n") || strings.ContainsAny(address.Address, "\r\n") {
+			return nil, fmt.Errorf("email address %q contains a line break", address.Address)
+		}
+	}
+
+	messageId, err := newMessageId(m.From.Address)
+	if err != nil {
+		return nil, err
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	err = writePart(parts, "text/plain; charset=UTF-8", m.Text)
+	if err != nil {
+		return nil, err
+	}
+	err = writePart(parts, "text/html; charset=UTF-8", m.HTML)
+	if err != nil {
+		return nil, err
+	}
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To.String())
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", messageId)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n", parts.Boundary())
+	fmt.Fprintf(&msg, "\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// Writes one quoted-printable body part.
+func writePart(parts *multipart.Writer, contentType string, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, err := parts.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoder := quotedprintable.NewWriter(part)
+	_, err = encoder.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n")))
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// Generates a unique Message-ID on the sender's domain.
+func newMessageId(from string) (string, error) {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain), nil
+}
@@ -0,0 +1,54 @@
+package email
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageAddresses(t *testing.T) {
+	from := mail.Address{Address: "trades@gametrader.test"}
+
+	tests := []struct {
+		name  string
+		to    mail.Address
+		valid bool
+		// The To header, as it appears in the message
+		header string
+	}{
+		{"address", mail.Address{Address: "alice@example.com"}, true, "<alice@example.com>"},
+		{"name", mail.Address{Name: "Alice", Address: "alice@example.com"}, true, `"Alice" <alice@example.com>`},
+		{"quoted name", mail.Address{Name: `Alice "Al" Smith`, Address: "alice@example.com"}, true, `"Alice \"Al\" Smith" <alice@example.com>`},
+		{"non-ASCII name", mail.Address{Name: "Zoë", Address: "zoe@example.com"}, true, "=?utf-8?q?Zo=C3=AB?= <zoe@example.com>"},
+		{"line break in name", mail.Address{Name: "Alice\r\nBcc: eve@example.com", Address: "alice@example.com"}, false, ""},
+		{"line break in address", mail.Address{Address: "alice@example.com\nBcc: eve@example.com"}, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg, err := (&Message{From: from, To: test.to, Subject: "Hello", Text: "Hi", HTML: "<p>Hi</p>"}).Bytes()
+			if !test.valid {
+				if err == nil {
+					t.Fatalf("expected the message to be rejected, got\n%s", msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header.Get("To") != test.header {
+				t.Errorf("expected To header %q, got %q", test.header, parsed.Header.Get("To"))
+			}
+			if parsed.Header.Get("From") != "<trades@gametrader.test>" {
+				t.Errorf("expected From header %q, got %q", "<trades@gametrader.test>", parsed.Header.Get("From"))
+			}
+			if len(parsed.Header["Bcc"]) != 0 {
+				t.Errorf("expected no Bcc header, got %v", parsed.Header["Bcc"])
+			}
+		})
+	}
+}
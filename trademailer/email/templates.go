@@ -0,0 +1,116 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	textSuffix = ".txt.tmpl"
+	htmlSuffix = ".html.tmpl"
+	// Files starting with this prefix hold shared {{define}} blocks and are parsed into every template
+	partialPrefix = "_"
+)
+
+// Email templates loaded from a directory. Each email is a pair of files named after it:
+// <name>.txt.tmpl for the plain text part and <name>.html.tmpl for the HTML part. The text
+// template must also define a "subject" block.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+func LoadTemplates(dir string) (*Templates, error) {
+	textPartials, err := filepath.Glob(filepath.Join(dir, partialPrefix+"*"+textSuffix))
+	if err != nil {
+		return nil, err
+	}
+	htmlPartials, err := filepath.Glob(filepath.Join(dir, partialPrefix+"*"+htmlSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	textFiles, err := filepath.Glob(filepath.Join(dir, "*"+textSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		text: map[string]*texttemplate.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+	for _, textFile := range textFiles {
+		base := filepath.Base(textFile)
+		if strings.HasPrefix(base, partialPrefix) {
+			continue
+		}
+		name := strings.TrimSuffix(base, textSuffix)
+
+		text, err := texttemplate.New(base).Option("missingkey=error").ParseFiles(append([]string{textFile}, textPartials...)...)
+		if err != nil {
+			return nil, err
+		}
+		if text.Lookup("subject") == nil {
+			return nil, fmt.Errorf("email template %v does not define a subject", textFile)
+		}
+
+		htmlFile := filepath.Join(dir, name+htmlSuffix)
+		if _, err := os.Stat(htmlFile); err != nil {
+			return nil, fmt.Errorf("email template %v has no html part: %w", name, err)
+		}
+		html, err := htmltemplate.New(name + htmlSuffix).Option("missingkey=error").ParseFiles(append([]string{htmlFile}, htmlPartials...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		t.text[name] = text
+		t.html[name] = html
+	}
+
+	if len(t.text) == 0 {
+		return nil, fmt.Errorf("no email templates found in %v", dir)
+	}
+	return t, nil
+}
+
+// Reports whether there is a template for the email.
+func (t *Templates) Has(name string) bool {
+	_, ok := t.text[name]
+	return ok
+}
+
+// Renders the email's subject, plain text body and HTML body.
+func (t *Templates) Render(name string, data interface{}) (subject string, text string, html string, err error) {
+	textTemplate, ok := t.text[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("no email template named %v", name)
+	}
+
+	var buf bytes.Buffer
+	err = textTemplate.ExecuteTemplate(&buf, "subject", data)
+	if err != nil {
+		return "", "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	err = textTemplate.ExecuteTemplate(&buf, name+textSuffix, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	text = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	err = t.html[name].ExecuteTemplate(&buf, name+htmlSuffix, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	html = buf.String()
+
+	return subject, text, html, nil
+}
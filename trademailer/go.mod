@@ -5,6 +5,8 @@ go 1.22.0
 require (
 	github.com/IBM/sarama v1.42.2
 	github.com/go-sql-driver/mysql v1.7.1
+	github.com/robertjshirts/events v0.0.0
+	golang.org/x/time v0.5.0
 )
 
 require (
@@ -27,3 +29,5 @@ require (
 	golang.org/x/crypto v0.19.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
 )
+
+replace github.com/robertjshirts/events => ../events
@@ -6,13 +6,22 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/robertjshirts/trademailer/consumer"
 	"github.com/robertjshirts/trademailer/dal"
+	"github.com/robertjshirts/trademailer/email"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "deadletters" {
+		os.Exit(runDeadLetters(os.Args[2:]))
+	}
+
 	dbConfig := ReadDatabaseConfig("config/database.config")
 	db, err := dal.Init(dbConfig["host"], dbConfig["port"], dbConfig["user"], dbConfig["password"], dbConfig["protocol"], dbConfig["database"])
 	if err != nil {
@@ -24,24 +33,162 @@ func main() {
 
 	kafkaConfig := ReadSaramaConfig("config/kafka.config")
 	brokers := strings.Split(kafkaConfig["brokers"], ",")
-	topics := []string{kafkaConfig["offerTopic"], kafkaConfig["userTopic"]}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// Cancelled on SIGINT or SIGTERM, which shuts everything down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rateLimit, err := strconv.ParseFloat(mailerConfig["rateLimit"], 64)
+	if err != nil {
+		log.Panicf("Error parsing mailer rate limit: %v", err)
+	}
+	burst, err := strconv.Atoi(mailerConfig["burst"])
+	if err != nil {
+		log.Panicf("Error parsing mailer burst: %v", err)
+	}
+	timeout, err := time.ParseDuration(mailerConfig["timeout"])
+	if err != nil {
+		log.Panicf("Error parsing mailer timeout: %v", err)
+	}
+
+	smtpConfig := consumer.SMTPConfig{
+		Host:      mailerConfig["host"],
+		Port:      mailerConfig["port"],
+		From:      mailerConfig["from"],
+		Username:  mailerConfig["username"],
+		Password:  mailerConfig["password"],
+		TLSMode:   mailerConfig["tlsMode"],
+		RateLimit: rateLimit,
+		Burst:     burst,
+		Timeout:   timeout,
+	}
+
+	templates, err := email.LoadTemplates(mailerConfig["templates"])
+	if err != nil {
+		log.Panicf("Error loading email templates: %v", err)
+	}
+	smtpNotifier, err := consumer.NewSMTPNotifier(smtpConfig, templates)
+	if err != nil {
+		log.Panicf("Error initializing SMTP notifier: %v", err)
+	}
+
+	notifierConfig := ReadNotifierConfig("config/notifier.config")
+	routes, err := initRoutes(smtpNotifier, notifierConfig)
+	if err != nil {
+		log.Panicf("Error initializing notifiers: %v", err)
+	}
+
+	digests, err := initDigester(db, smtpNotifier, notifierConfig)
+	if err != nil {
+		log.Panicf("Error initializing digests: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		digests.Run(ctx)
+	}()
+
+	// Each configured topic is handled by the handler for its family of events
+	registry := consumer.NewRegistry()
+	err = registry.Register(kafkaConfig["offerTopic"], consumer.NewOfferHandler(db))
+	if err != nil {
+		log.Panicf("Error registering topic handler: %v", err)
+	}
+	err = registry.Register(kafkaConfig["userTopic"], consumer.NewUserHandler(db))
+	if err != nil {
+		log.Panicf("Error registering topic handler: %v", err)
+	}
+
+	workers, err := strconv.Atoi(kafkaConfig["workers"])
+	if err != nil {
+		log.Panicf("Error parsing worker count: %v", err)
+	}
 
-	// Should add mailerConfig user and pass if using a real mailer
-	consumer, err := consumer.Init(db, brokers, kafkaConfig["group"], topics, mailerConfig["host"], mailerConfig["port"])
+	partitions, err := strconv.ParseInt(kafkaConfig["partitions"], 10, 32)
+	if err != nil {
+		log.Panicf("Error parsing partitions: %v", err)
+	}
+	replicationFactor, err := strconv.ParseInt(kafkaConfig["replicationFactor"], 10, 16)
+	if err != nil {
+		log.Panicf("Error parsing replication factor: %v", err)
+	}
+	err = consumer.CreateTopics(brokers, consumer.DeliveryTopics(kafkaConfig["retryTopic"], kafkaConfig["deadLetterTopic"]), int32(partitions), int16(replicationFactor))
+	if err != nil {
+		log.Panicf("Error creating retry and dead-letter topics: %v", err)
+	}
+
+	consumer, err := consumer.Init(db, brokers, kafkaConfig["group"], workers, registry, kafkaConfig["retryTopic"], kafkaConfig["deadLetterTopic"], routes, digests)
 	if err != nil {
 		log.Panicf("Error initializing consumer: %v", err)
 	}
-	defer consumer.Close()
+
+	go func() {
+		for err := range consumer.Errors() {
+			fmt.Printf("Consumer group error: %v\n", err)
+		}
+	}()
 
 	fmt.Println("Consumer initialized")
-	consumer.Consume(ctx)
+	err = consumer.Consume(ctx)
+	if err != nil {
+		fmt.Printf("Error consuming: %v\n", err)
+	}
+
+	// Stop everything else before closing the consumer, which commits the marked offsets
+	stop()
+	fmt.Println("Shutting down...")
+	err = consumer.Close()
+	if err != nil {
+		fmt.Printf("Error closing consumer: %v\n", err)
+	}
+	wg.Wait()
+}
+
+// Sets up the notification channels and the routes that pick between them. The webhook channel is
+// only available when a webhook URL is configured.
+func initRoutes(smtpNotifier *consumer.SMTPNotifier, notifierConfig map[string]string) (*consumer.Routes, error) {
+	fileNotifier, err := consumer.NewFileNotifier(notifierConfig["filePath"])
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers := map[string]consumer.Notifier{
+		consumer.SMTPChannel: smtpNotifier,
+		consumer.FileChannel: fileNotifier,
+	}
+
+	if notifierConfig["webhookUrl"] != "" {
+		timeout, err := time.ParseDuration(notifierConfig["webhookTimeout"])
+		if err != nil {
+			return nil, err
+		}
+		webhookNotifier, err := consumer.NewWebhookNotifier(notifierConfig["webhookUrl"], notifierConfig["webhookSecret"], timeout)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[consumer.WebhookChannel] = webhookNotifier
+	}
+
+	return consumer.NewRoutes(notifiers, notifierConfig)
+}
+
+// Sets up the digester that sends daily and weekly digests at the configured hour (UTC) and weekday.
+func initDigester(db *dal.SQLDatastore, smtpNotifier *consumer.SMTPNotifier, notifierConfig map[string]string) (*consumer.Digester, error) {
+	hour, err := strconv.Atoi(notifierConfig["digestHour"])
+	if err != nil {
+		return nil, err
+	}
+
+	weekday := -1
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), notifierConfig["digestWeekday"]) {
+			weekday = int(day)
+		}
+	}
+	if weekday < 0 {
+		return nil, fmt.Errorf("unknown digest weekday %q", notifierConfig["digestWeekday"])
+	}
 
-	// Handle graceful shutdown
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
-	<-signals
-	cancel()
+	return consumer.NewDigester(db, smtpNotifier, nil, hour, time.Weekday(weekday))
 }
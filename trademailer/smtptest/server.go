@@ -0,0 +1,172 @@
+// Package smtptest provides an in-process SMTP server that captures the messages sent to it, for
+// testing code that sends email without a real mail server.
+package smtptest
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A message the server accepted
+type Message struct {
+	From string
+	To   []string
+	// The message as sent, headers included, with CRLF line endings converted to LF
+	Data []byte
+}
+
+// An SMTP server listening on a random local port. It accepts every message without authentication
+// or TLS, so clients must be configured to send in plaintext.
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Message
+	received chan struct{}
+}
+
+// Starts a server on 127.0.0.1. Close it when done.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		received: make(chan struct{}, 1),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+func (s *Server) Port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+// Returns the messages accepted so far, in the order they were received.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+// Waits until the server has accepted at least n messages and returns them.
+func (s *Server) WaitForMessages(n int, timeout time.Duration) ([]Message, error) {
+	deadline := time.After(timeout)
+	for {
+		messages := s.Messages()
+		if len(messages) >= n {
+			return messages, nil
+		}
+		select {
+		case <-s.received:
+		case <-deadline:
+			return messages, fmt.Errorf("received %v messages after %v, want %v", len(messages), timeout, n)
+		}
+	}
+}
+
+// Stops accepting connections and waits for open ones to finish.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Speaks just enough SMTP for net/smtp: EHLO, HELO, MAIL, RCPT, DATA, RSET, NOOP and QUIT.
+func (s *Server) handle(netConn net.Conn) {
+	conn := textproto.NewConn(netConn)
+	defer conn.Close()
+	netConn.SetDeadline(time.Now().Add(time.Minute))
+
+	var message Message
+	conn.PrintfLine("220 smtptest ESMTP ready")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			conn.PrintfLine("250-smtptest")
+			conn.PrintfLine("250 8BITMIME")
+		case "HELO", "NOOP":
+			conn.PrintfLine("250 OK")
+		case "MAIL":
+			message = Message{From: address(arg)}
+			conn.PrintfLine("250 OK")
+		case "RCPT":
+			message.To = append(message.To, address(arg))
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.Data = data
+			s.accept(message)
+			message = Message{}
+			conn.PrintfLine("250 OK")
+		case "RSET":
+			message = Message{}
+			conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func (s *Server) accept(message Message) {
+	s.mu.Lock()
+	s.messages = append(s.messages, message)
+	s.mu.Unlock()
+
+	select {
+	case s.received <- struct{}{}:
+	default:
+	}
+}
+
+// Extracts the address from a MAIL or RCPT argument such as "FROM:<a@b.com> BODY=8BITMIME".
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
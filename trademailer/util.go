@@ -9,10 +9,15 @@ import (
 
 func defaultSaramaConfig() map[string]string {
 	return map[string]string{
-		"brokers":    "kafka:9092",
-		"offerTopic": "offer",
-		"userTopic":  "user",
-		"group":      "trademailer-consumer-group",
+		"brokers":           "kafka:9092",
+		"offerTopic":        "offer",
+		"userTopic":         "user",
+		"retryTopic":        "notification-retry",
+		"deadLetterTopic":   "notification-dead-letter",
+		"group":             "trademailer-consumer-group",
+		"workers":           "4",
+		"partitions":        "1",
+		"replicationFactor": "1",
 	}
 }
 
@@ -91,8 +96,16 @@ func ReadDatabaseConfig(configFile string) map[string]string {
 
 func defualtMailerConfig() map[string]string {
 	return map[string]string{
-		"host": "smtp.gmail.com",
-		"port": "587",
+		"host":      "smtp.gmail.com",
+		"port":      "587",
+		"from":      "gametrader@localhost",
+		"username":  "",
+		"password":  "",
+		"tlsMode":   "starttls",
+		"templates": "templates",
+		"rateLimit": "5",
+		"burst":     "5",
+		"timeout":   "30s",
 	}
 }
 
@@ -126,3 +139,46 @@ func ReadMailerConfig(configFile string) map[string]string {
 
 	return m
 }
+
+func defaultNotifierConfig() map[string]string {
+	return map[string]string{
+		"default":        "smtp",
+		"webhookUrl":     "",
+		"webhookSecret":  "",
+		"webhookTimeout": "10s",
+		"filePath":       "-",
+		"digestHour":     "8",
+		"digestWeekday":  "monday",
+	}
+}
+
+func ReadNotifierConfig(configFile string) map[string]string {
+	m := defaultNotifierConfig()
+
+	file, err := os.Open(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening notifier config file: %v\n", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") && len(line) > 0 {
+			before, after, found := strings.Cut(line, "=")
+			if found {
+				parameter := strings.TrimSpace(before)
+				value := strings.TrimSpace(after)
+				m[parameter] = value
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Failed to read file: %s", err)
+		os.Exit(1)
+	}
+
+	return m
+}